@@ -0,0 +1,312 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// sessionLifetime is the time a session stays valid after logging in.
+const sessionLifetime = 30 * 24 * time.Hour
+
+// Errors returned by the account system.
+var (
+	ErrAccountNotFound = errors.New("no such account")
+	ErrAccountExists   = errors.New("the username is already registered")
+	ErrWrongPassword   = errors.New("wrong username or password")
+	ErrSessionNotFound = errors.New("no such session")
+)
+
+// Account is a registered user. Registered usernames are reserved, so that
+// only their owner can play under them.
+type Account struct {
+	Username string
+	Hash     []byte // The bcrypt hash of the password.
+	Created  time.Time
+}
+
+// LoginSession is a logged-in account.
+type LoginSession struct {
+	Username string
+	Expires  time.Time
+}
+
+// AccountStore represents a storage of accounts, keyed by username,
+// and of their login sessions, keyed by a hash of the session token.
+type AccountStore interface {
+	// Get returns the account, or ErrAccountNotFound.
+	Get(name string) (Account, error)
+	// Create saves a new account, or returns ErrAccountExists.
+	Create(a Account) error
+	// GetSession returns the session, or ErrSessionNotFound.
+	GetSession(key string) (LoginSession, error)
+	// PutSession saves the session.
+	PutSession(key string, s LoginSession) error
+	// DeleteSession removes the session, if it exists.
+	DeleteSession(key string) error
+	// PruneSessions removes the sessions that have expired by now.
+	PruneSessions(now time.Time) error
+}
+
+type memoryAccounts struct {
+	mu       sync.RWMutex
+	accounts map[string]Account
+	sessions map[string]LoginSession
+}
+
+func (m *memoryAccounts) Get(name string) (Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	a, ok := m.accounts[name]
+	if !ok {
+		return a, ErrAccountNotFound
+	}
+	return a, nil
+}
+
+func (m *memoryAccounts) Create(a Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.accounts[a.Username]; ok {
+		return ErrAccountExists
+	}
+	m.accounts[a.Username] = a
+	return nil
+}
+
+func (m *memoryAccounts) GetSession(key string) (LoginSession, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[key]
+	if !ok {
+		return s, ErrSessionNotFound
+	}
+	return s, nil
+}
+
+func (m *memoryAccounts) PutSession(key string, s LoginSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[key] = s
+	return nil
+}
+
+func (m *memoryAccounts) DeleteSession(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, key)
+	return nil
+}
+
+func (m *memoryAccounts) PruneSessions(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, s := range m.sessions {
+		if now.After(s.Expires) {
+			delete(m.sessions, key)
+		}
+	}
+	return nil
+}
+
+// MemoryAccounts returns an AccountStore that keeps everything in memory.
+func MemoryAccounts() AccountStore {
+	return &memoryAccounts{accounts: make(map[string]Account), sessions: make(map[string]LoginSession)}
+}
+
+// Accounts handles registration and the login sessions.
+type Accounts struct {
+	Store AccountStore
+	// The content filter of usernames. If nil, usernames are not filtered.
+	Moderation *Moderation
+	// The flood protection of registering and logging in. If nil, there is none.
+	Limiter *Limiter
+}
+
+// NewAccounts returns a new account system over the store.
+// Expired sessions are removed from the store periodically.
+func NewAccounts(store AccountStore) *Accounts {
+	as := &Accounts{Store: store}
+	go as.sweep()
+	return as
+}
+
+// sweep periodically removes the expired sessions.
+func (as *Accounts) sweep() {
+	for now := range time.Tick(time.Hour) {
+		if err := as.Store.PruneSessions(now); err != nil {
+			log.Printf("Cannot prune sessions: %v\n", err)
+		}
+	}
+}
+
+// sessionKey returns the key a session is stored under, so that the store does not hold usable tokens.
+func sessionKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Register creates a new account.
+func (as *Accounts) Register(username, password string) error {
+	if !validUsername(username) {
+		return errors.New("invalid username")
+	}
+	// Account names are kept forever, so they cannot be masked.
+	if filtered, err := as.Moderation.Username(username); err != nil || filtered != username {
+		return errors.New("the username contains disallowed words")
+	}
+	if len(password) < 8 {
+		return errors.New("the password must have at least 8 characters")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return as.Store.Create(Account{
+		Username: username,
+		Hash:     hash,
+		Created:  time.Now(),
+	})
+}
+
+// Login checks the password, and returns a new session token.
+func (as *Accounts) Login(username, password string) (string, error) {
+	a, err := as.Store.Get(username)
+	if err == ErrAccountNotFound {
+		return "", ErrWrongPassword
+	}
+	if err != nil {
+		return "", err
+	}
+	if bcrypt.CompareHashAndPassword(a.Hash, []byte(password)) != nil {
+		return "", ErrWrongPassword
+	}
+	token := randToken()
+	err = as.Store.PutSession(sessionKey(token), LoginSession{
+		Username: a.Username,
+		Expires:  time.Now().Add(sessionLifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Logout ends the session.
+func (as *Accounts) Logout(token string) {
+	if err := as.Store.DeleteSession(sessionKey(token)); err != nil {
+		log.Printf("Cannot log out: %v\n", err)
+	}
+}
+
+// Session returns the username logged in with the token.
+func (as *Accounts) Session(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	s, err := as.Store.GetSession(sessionKey(token))
+	if err != nil {
+		if err != ErrSessionNotFound {
+			log.Printf("Cannot get session: %v\n", err)
+		}
+		return "", false
+	}
+	if time.Now().After(s.Expires) {
+		as.Logout(token)
+		return "", false
+	}
+	return s.Username, true
+}
+
+// Reserved returns whether the username belongs to an account.
+func (as *Accounts) Reserved(username string) bool {
+	_, err := as.Store.Get(username)
+	return err != ErrAccountNotFound
+}
+
+// Identify returns the user joining with the given username and session token.
+// A valid session takes precedence over the username; registered usernames
+// cannot be used without their session.
+// Without an account system (as is nil), only the username is checked.
+func (as *Accounts) Identify(username, token string) (User, error) {
+	if as == nil {
+		if !validUsername(username) {
+			return User{}, errors.New("invalid username")
+		}
+		return NewUser(username), nil
+	}
+	if name, ok := as.Session(token); ok {
+		u := NewUser(name)
+		u.Registered = true
+		return u, nil
+	}
+	if token != "" {
+		return User{}, errors.New("invalid session")
+	}
+	if !validUsername(username) {
+		return User{}, errors.New("invalid username")
+	}
+	if as.Reserved(username) {
+		return User{}, errors.New("the username is registered, please log in")
+	}
+	return NewUser(username), nil
+}
+
+// writeJSON writes a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		code, data = 500, []byte("{\"error\": \"Server error\"}")
+	}
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+// writeError writes a JSON error response.
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// ServeHTTP serves /register, /login and /logout, all by POST.
+// Registering and logging in count against the connect limit, as checking passwords is costly.
+func (as *Accounts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(405)
+		return
+	}
+	if r.URL.Path != "/logout" {
+		if err := as.Limiter.Connect(clientIP(r)); err != nil {
+			writeError(w, 429, err)
+			return
+		}
+	}
+	r.ParseForm()
+	username, password := r.FormValue("username"), r.FormValue("password")
+	switch r.URL.Path {
+	case "/register":
+		if err := as.Register(username, password); err != nil {
+			writeError(w, 400, err)
+			return
+		}
+		fallthrough
+	case "/login":
+		token, err := as.Login(username, password)
+		if err != nil {
+			writeError(w, 403, err)
+			return
+		}
+		writeJSON(w, 200, map[string]string{"username": username, "token": token})
+	case "/logout":
+		as.Logout(r.FormValue("token"))
+		writeJSON(w, 200, map[string]bool{"success": true})
+	default:
+		w.WriteHeader(404)
+	}
+}
@@ -0,0 +1,118 @@
+package backend
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccountStore(t *testing.T) {
+	stores := []struct {
+		name  string
+		store AccountStore
+	}{
+		{"memory", MemoryAccounts()},
+		{"bolt", testBolt(t).Accounts()},
+	}
+	now := time.Now()
+	for _, s := range stores {
+		if err := s.store.Create(Account{Username: "alice", Hash: []byte("hash")}); err != nil {
+			t.Errorf("%s: Create() = %v", s.name, err)
+		}
+		if err := s.store.Create(Account{Username: "alice", Hash: []byte("other")}); err != ErrAccountExists {
+			t.Errorf("%s: Create() of a taken username = %v; want %v", s.name, err, ErrAccountExists)
+		}
+		if a, err := s.store.Get("alice"); err != nil || string(a.Hash) != "hash" {
+			t.Errorf("%s: Get() = %+v, %v; want the first account", s.name, a, err)
+		}
+		if _, err := s.store.Get("bob"); err != ErrAccountNotFound {
+			t.Errorf("%s: Get() of an unknown username = %v; want %v", s.name, err, ErrAccountNotFound)
+		}
+
+		s.store.PutSession("live", LoginSession{Username: "alice", Expires: now.Add(time.Hour)})
+		s.store.PutSession("expired", LoginSession{Username: "alice", Expires: now.Add(-time.Hour)})
+		s.store.PutSession("deleted", LoginSession{Username: "alice", Expires: now.Add(time.Hour)})
+		s.store.DeleteSession("deleted")
+		s.store.DeleteSession("unknown")
+		if err := s.store.PruneSessions(now); err != nil {
+			t.Errorf("%s: PruneSessions() = %v", s.name, err)
+		}
+		tests := []struct {
+			key string
+			err error
+		}{
+			{"live", nil},
+			{"expired", ErrSessionNotFound},
+			{"deleted", ErrSessionNotFound},
+			{"unknown", ErrSessionNotFound},
+		}
+		for _, tt := range tests {
+			if sess, err := s.store.GetSession(tt.key); err != tt.err || err == nil && sess.Username != "alice" {
+				t.Errorf("%s: GetSession(%q) = %+v, %v; want %v", s.name, tt.key, sess, err, tt.err)
+			}
+		}
+	}
+}
+
+func TestAccountsLogin(t *testing.T) {
+	as := NewAccounts(MemoryAccounts())
+	if err := as.Register("alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	token, err := as.Login("alice", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loggedOut, _ := as.Login("alice", "password")
+	as.Logout(loggedOut)
+
+	tests := []struct {
+		name  string
+		token string
+		user  string
+		ok    bool
+	}{
+		{"logged in", token, "alice", true},
+		{"logged out", loggedOut, "", false},
+		{"stored key", sessionKey(token), "", false},
+		{"empty", "", "", false},
+	}
+	for _, tt := range tests {
+		if user, ok := as.Session(tt.token); user != tt.user || ok != tt.ok {
+			t.Errorf("%s: Session() = %q, %v; want %q, %v", tt.name, user, ok, tt.user, tt.ok)
+		}
+	}
+	if _, err := as.Login("alice", "wrong password"); err != ErrWrongPassword {
+		t.Errorf("Login() with a wrong password = %v; want %v", err, ErrWrongPassword)
+	}
+	if _, err := as.Login("bob", "password"); err != ErrWrongPassword {
+		t.Errorf("Login() of an unknown username = %v; want %v", err, ErrWrongPassword)
+	}
+}
+
+func TestAccountsServeHTTPLimit(t *testing.T) {
+	as := NewAccounts(MemoryAccounts())
+	as.Limiter = NewLimiter(Limits{ConnectRate: 0.001, ConnectBurst: 2})
+	tests := []struct {
+		name string
+		path string
+		code int
+	}{
+		{"register", "/register", 200},
+		{"login", "/login", 200},
+		{"login flood", "/login", 429},
+		{"logout", "/logout", 200},
+	}
+	form := url.Values{"username": {"alice"}, "password": {"password"}}.Encode()
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", tt.path, strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		as.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d; want %d", tt.name, w.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package backend
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Admin serves the operators' moderation API under /admin/.
+// Every request must carry the admin token, as "Authorization: Bearer <token>".
+type Admin struct {
+	Token string // The admin token. If empty, every request is refused.
+	Rooms *Rooms
+	Bans  *Bans
+}
+
+// adminRoomInfo is a live room listing entry, with what operators need to intervene.
+type adminRoomInfo struct {
+	ID        int        `json:"id"`
+	Members   []User     `json:"members"`
+	Status    []Status   `json:"status"`
+	Sentences []Sentence `json:"sentences"`
+	Turn      int        `json:"turn"`
+	Start     time.Time  `json:"start"`
+	Private   bool       `json:"private"`
+	Ended     bool       `json:"ended"`
+}
+
+// authorized checks the request's admin token.
+func (a *Admin) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return a.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) == 1
+}
+
+// ServeHTTP serves:
+//
+//	GET    /admin/rooms                        lists the live rooms.
+//	POST   /admin/rooms/{id}/kick              kicks the member with index "member".
+//	POST   /admin/rooms/{id}/redact            redacts the sentence at position "sentence".
+//	GET    /admin/reports                      lists the reports waiting for review, including the content the filter flagged.
+//	POST   /admin/reports/{room}/{id}/accept   accepts the report, banning its target for "duration":
+//	                                           their account if registered, and their address if
+//	                                           "ip" is set or they are not registered.
+//	POST   /admin/reports/{room}/{id}/dismiss  dismisses the report.
+//	GET    /admin/bans                         lists the bans in effect.
+//	POST   /admin/bans                         bans the registered "account" and/or "ip" for "duration"
+//	                                           (e.g. "24h"), with an optional "reason".
+//	DELETE /admin/bans                         lifts the bans of "account" or "ip".
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		writeError(w, 401, errors.New("unauthorized"))
+		return
+	}
+	r.ParseForm()
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/"), "/"), "/")
+	switch {
+	case len(path) == 1 && path[0] == "rooms" && r.Method == "GET":
+		a.listRooms(w)
+	case len(path) == 3 && path[0] == "rooms" && r.Method == "POST":
+		a.serveRoomAction(w, r, path[1], path[2])
+	case len(path) == 1 && path[0] == "reports" && r.Method == "GET":
+		a.listReports(w)
+	case len(path) == 4 && path[0] == "reports" && r.Method == "POST":
+		a.serveReview(w, r, path[1], path[2], path[3])
+	case len(path) == 1 && path[0] == "bans":
+		a.serveBans(w, r)
+	default:
+		w.WriteHeader(404)
+	}
+}
+
+func (a *Admin) listRooms(w http.ResponseWriter) {
+	list := make([]adminRoomInfo, 0)
+	for _, h := range a.Rooms.Live() {
+		room := h.current()
+		list = append(list, adminRoomInfo{
+			ID:        room.ID,
+			Members:   room.Members,
+			Status:    room.Status,
+			Sentences: room.Sentences,
+			Turn:      room.Turn,
+			Start:     room.Start,
+			Private:   room.Private,
+			Ended:     room.Ended(),
+		})
+	}
+	writeJSON(w, 200, list)
+}
+
+func (a *Admin) serveRoomAction(w http.ResponseWriter, r *http.Request, idStr, action string) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		writeError(w, 400, errors.New("invalid room ID"))
+		return
+	}
+	room, err := a.Rooms.Get(id)
+	if err != nil {
+		writeError(w, 404, err)
+		return
+	}
+	switch action {
+	case "kick":
+		member, perr := strconv.Atoi(r.FormValue("member"))
+		if perr != nil {
+			writeError(w, 400, errors.New("invalid member"))
+			return
+		}
+		err = room.Kick(member)
+	case "redact":
+		pos, perr := strconv.Atoi(r.FormValue("sentence"))
+		if perr != nil {
+			writeError(w, 400, errors.New("invalid sentence"))
+			return
+		}
+		err = room.Redact(pos)
+	default:
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		writeError(w, 400, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (a *Admin) listReports(w http.ResponseWriter) {
+	list, err := a.Rooms.PendingReports()
+	if err != nil {
+		writeError(w, 500, err)
+		return
+	}
+	writeJSON(w, 200, list)
+}
+
+func (a *Admin) serveReview(w http.ResponseWriter, r *http.Request, roomStr, idStr, action string) {
+	roomID, err := strconv.Atoi(roomStr)
+	if err != nil {
+		writeError(w, 400, errors.New("invalid room ID"))
+		return
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		writeError(w, 400, errors.New("invalid report ID"))
+		return
+	}
+	room, err := a.Rooms.Get(roomID)
+	if err != nil {
+		writeError(w, 404, err)
+		return
+	}
+	switch action {
+	case "accept":
+		duration, err := time.ParseDuration(r.FormValue("duration"))
+		if err != nil || duration <= 0 {
+			writeError(w, 400, errors.New("invalid duration"))
+			return
+		}
+		rp, err := room.Review(id, ReportAccepted)
+		if err != nil {
+			writeError(w, 400, err)
+			return
+		}
+		ban := Ban{Reason: rp.Reason, Until: time.Now().Add(duration)}
+		if rp.Registered {
+			ban.Account = rp.Target
+		}
+		if r.FormValue("ip") != "" || !rp.Registered {
+			ban.IP = rp.TargetIP
+		}
+		if ban.Account == "" && ban.IP == "" {
+			writeError(w, 422, errors.New("the report is accepted, but its target is not registered and their address is unknown"))
+			return
+		}
+		a.Bans.Add(ban)
+		writeJSON(w, 200, ban)
+	case "dismiss":
+		if _, err := room.Review(id, ReportDismissed); err != nil {
+			writeError(w, 400, err)
+			return
+		}
+		w.WriteHeader(204)
+	default:
+		w.WriteHeader(404)
+	}
+}
+
+func (a *Admin) serveBans(w http.ResponseWriter, r *http.Request) {
+	account, ip := r.FormValue("account"), r.FormValue("ip")
+	switch r.Method {
+	case "GET":
+		writeJSON(w, 200, a.Bans.List())
+	case "POST":
+		if account == "" && ip == "" {
+			writeError(w, 400, errors.New("an account or an ip is needed"))
+			return
+		}
+		duration, err := time.ParseDuration(r.FormValue("duration"))
+		if err != nil || duration <= 0 {
+			writeError(w, 400, errors.New("invalid duration"))
+			return
+		}
+		ban := Ban{Account: account, IP: ip, Reason: r.FormValue("reason"), Until: time.Now().Add(duration)}
+		a.Bans.Add(ban)
+		writeJSON(w, 200, ban)
+	case "DELETE":
+		if account == "" && ip == "" {
+			writeError(w, 400, errors.New("an account or an ip is needed"))
+			return
+		}
+		writeJSON(w, 200, map[string]int{"lifted": a.Bans.Lift(account, ip)})
+	default:
+		w.WriteHeader(405)
+	}
+}
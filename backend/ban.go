@@ -0,0 +1,160 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Ban keeps an account or an address out of matchmaking until it expires.
+// Player IDs are issued anew on every visit, and anyone can play under an
+// unregistered username, so only registered accounts and addresses are banned.
+type Ban struct {
+	Account string    `json:"account,omitempty"` // The username of the registered account.
+	IP      string    `json:"ip,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Until   time.Time `json:"until"`
+}
+
+// matches returns whether the ban applies to the user or address.
+func (b Ban) matches(user User, ip string) bool {
+	return (b.Account != "" && user.Registered && b.Account == user.Username) || (b.IP != "" && b.IP == ip)
+}
+
+// BanStore represents a storage of the bans.
+type BanStore interface {
+	// List returns the stored bans, including expired ones.
+	List() ([]Ban, error)
+	// Save replaces the stored bans.
+	Save(bans []Ban) error
+}
+
+type memoryBans struct {
+	mu   sync.Mutex
+	bans []Ban
+}
+
+func (m *memoryBans) List() ([]Ban, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Ban(nil), m.bans...), nil
+}
+
+func (m *memoryBans) Save(bans []Ban) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bans = append([]Ban(nil), bans...)
+	return nil
+}
+
+// MemoryBans returns a BanStore that keeps everything in memory.
+func MemoryBans() BanStore {
+	return &memoryBans{}
+}
+
+// Bans is the list of bans, saved into its store as it changes.
+// A nil Bans bans nobody.
+type Bans struct {
+	mu    sync.Mutex
+	bans  []Ban
+	store BanStore
+}
+
+// NewBans returns the bans kept in the store.
+func NewBans(store BanStore) (*Bans, error) {
+	bans, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	b := &Bans{bans: bans, store: store}
+	b.prune(time.Now())
+	return b, nil
+}
+
+// save writes the bans into the store, if any.
+// It must be called with the lock held.
+func (b *Bans) save() {
+	if b.store == nil {
+		return
+	}
+	if err := b.store.Save(b.bans); err != nil {
+		log.Printf("Cannot save the bans: %v\n", err)
+	}
+}
+
+// prune removes the expired bans.
+// It must be called with the lock held.
+func (b *Bans) prune(now time.Time) {
+	kept := b.bans[:0]
+	for _, ban := range b.bans {
+		if now.Before(ban.Until) {
+			kept = append(kept, ban)
+		}
+	}
+	b.bans = kept
+}
+
+// Add adds a ban.
+func (b *Bans) Add(ban Ban) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(time.Now())
+	b.bans = append(b.bans, ban)
+	b.save()
+}
+
+// Lift removes the bans of the account or address, returning how many there were.
+func (b *Bans) Lift(account, ip string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	kept := b.bans[:0]
+	for _, ban := range b.bans {
+		if !ban.matches(User{Username: account, Registered: true}, ip) {
+			kept = append(kept, ban)
+		}
+	}
+	lifted := len(b.bans) - len(kept)
+	b.bans = kept
+	b.save()
+	return lifted
+}
+
+// List returns the bans in effect.
+func (b *Bans) List() []Ban {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(time.Now())
+	return append([]Ban{}, b.bans...)
+}
+
+// Check returns an error if the user, by their account, or their address is banned.
+func (b *Bans) Check(user User, ip string) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(time.Now())
+	for _, ban := range b.bans {
+		if !ban.matches(user, ip) {
+			continue
+		}
+		if ban.Reason != "" {
+			return fmt.Errorf("you are banned until %s: %s", ban.Until.Format(time.RFC1123), ban.Reason)
+		}
+		return fmt.Errorf("you are banned until %s", ban.Until.Format(time.RFC1123))
+	}
+	return nil
+}
+
+// clientIP returns the address of the client making the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
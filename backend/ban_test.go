@@ -0,0 +1,81 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBansCheck(t *testing.T) {
+	bans, _ := NewBans(MemoryBans())
+	until := time.Now().Add(time.Hour)
+	bans.Add(Ban{Account: "mallory", Until: until})
+	bans.Add(Ban{IP: "6.6.6.6", Reason: "spam", Until: until})
+	bans.Add(Ban{Account: "eve", Until: time.Now().Add(-time.Minute)})
+
+	mallory := User{ID: "m", Username: "mallory", Registered: true}
+	tests := []struct {
+		name   string
+		bans   *Bans
+		user   User
+		ip     string
+		banned bool
+	}{
+		{"nil", nil, mallory, "6.6.6.6", false},
+		{"banned account", bans, mallory, "1.1.1.1", true},
+		{"unregistered namesake", bans, User{ID: "x", Username: "mallory"}, "1.1.1.1", false},
+		{"banned address", bans, User{ID: "y", Username: "guest"}, "6.6.6.6", true},
+		{"expired ban", bans, User{ID: "e", Username: "eve", Registered: true}, "1.1.1.1", false},
+		{"someone else", bans, User{ID: "a", Username: "alice", Registered: true}, "1.1.1.1", false},
+	}
+	for _, tt := range tests {
+		if err := tt.bans.Check(tt.user, tt.ip); (err != nil) != tt.banned {
+			t.Errorf("%s: Check() = %v; want banned = %v", tt.name, err, tt.banned)
+		}
+	}
+	if n := len(bans.List()); n != 2 {
+		t.Errorf("List() has %d bans; want 2, without the expired one", n)
+	}
+}
+
+func TestBanStore(t *testing.T) {
+	stores := []struct {
+		name  string
+		store BanStore
+	}{
+		{"memory", MemoryBans()},
+		{"bolt", testBolt(t).Bans()},
+	}
+	until := time.Now().Add(time.Hour)
+	for _, s := range stores {
+		bans, err := NewBans(s.store)
+		if err != nil {
+			t.Fatalf("%s: NewBans() = %v", s.name, err)
+		}
+		bans.Add(Ban{Account: "mallory", Until: until})
+		bans.Add(Ban{IP: "6.6.6.6", Until: until})
+		bans.Add(Ban{Account: "trudy", IP: "7.7.7.7", Until: until})
+		if lifted := bans.Lift("", "7.7.7.7"); lifted != 1 {
+			t.Errorf("%s: Lift() = %d; want 1", s.name, lifted)
+		}
+
+		// The bans survive a restart.
+		reloaded, err := NewBans(s.store)
+		if err != nil {
+			t.Fatalf("%s: NewBans() = %v", s.name, err)
+		}
+		tests := []struct {
+			user   User
+			ip     string
+			banned bool
+		}{
+			{User{Username: "mallory", Registered: true}, "", true},
+			{User{Username: "guest"}, "6.6.6.6", true},
+			{User{Username: "trudy", Registered: true}, "7.7.7.7", false},
+		}
+		for _, tt := range tests {
+			if err := reloaded.Check(tt.user, tt.ip); (err != nil) != tt.banned {
+				t.Errorf("%s: Check(%s, %q) after reloading = %v; want banned = %v", s.name, tt.user.Username, tt.ip, err, tt.banned)
+			}
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"io/ioutil"
 	"time"
 
 	"github.com/natsukagami/hakkero-project/backend"
@@ -10,14 +12,146 @@ import (
 var (
 	playerLimit = flag.Int("player", 4, "Set the player limit on each room.")
 	timeout     = flag.Int("timeout", 60, "Set the timeout of each turn")
+	minLength   = flag.Int("minlen", 1, "Set the minimum length of a sentence.")
+	maxLength   = flag.Int("maxlen", 0, "Set the maximum length of a sentence. 0 means unlimited.")
+	maxWords    = flag.Int("maxwords", 0, "Set the maximum number of words in a sentence. 0 means unlimited.")
+	punctuation = flag.Bool("punctuation", false, "Require sentences to end with a punctuation mark.")
+	single      = flag.Bool("single-sentence", false, "Require each turn to be exactly one sentence.")
+	maxRounds   = flag.Int("rounds", 0, "Set the number of rounds of each game. 0 means unlimited.")
+	wordBudget  = flag.Int("words", 0, "Set the number of words in the story of each game. 0 means unlimited.")
+	duration    = flag.Int("duration", 0, "Set the time (in seconds) of each game. 0 means unlimited.")
+	skips       = flag.Int("skips", 0, "Set the number of skips allowed before a player is out.")
+	category    = flag.String("category", "", "Set the category of opening sentences. Empty means any.")
+	spectators  = flag.Bool("spectators", true, "Allow guests to watch games.")
+	voting      = flag.Bool("voting", false, "End each game with a vote for the best sentence or author.")
+	voteTimeout = flag.Int("vote-timeout", 30, "Set the timeout of the voting phase.")
+	specVotes   = flag.Bool("spectator-votes", false, "Allow guests to vote.")
+	modes       = flag.String("modes", "", "Set the path of a JSON file of additional queue modes, mapping names to room settings.")
+	grace       = flag.Int("grace", 300, "Set the time (in seconds) a finished room stays live before being archived.")
+	database    = flag.String("db", "", "Set the path of the database. If empty, everything is kept in memory only.")
+	ratingRange = flag.Float64("rating-range", 100, "Set the rating difference players accept within a match.")
+	secret      = flag.String("secret", "", "Set the key signing player tokens. If empty, a random one is used, and players cannot rejoin after a restart.")
+	ratingWiden = flag.Float64("rating-widen", 10, "Set the rating difference players additionally accept per second of waiting.")
+	wordList    = flag.String("wordlist", "", "Set the path of a file of disallowed words, one per line. If empty, nothing is filtered.")
+	adminToken  = flag.String("admin-token", "", "Set the token of the admin API. If empty, the admin API is disabled.")
+	msgRate     = flag.Float64("msg-rate", 2, "Set the messages per second a connection can send, on average. 0 means unlimited.")
+	msgBurst    = flag.Int("msg-burst", 10, "Set the messages a connection can send at once.")
+	ipMsgRate   = flag.Float64("ip-msg-rate", 10, "Set the messages per second all connections of an address can send, on average. 0 means unlimited.")
+	ipMsgBurst  = flag.Int("ip-msg-burst", 30, "Set the messages all connections of an address can send at once.")
+	connRate    = flag.Float64("conn-rate", 1, "Set the connections per second an address can open, on average. 0 means unlimited.")
+	connBurst   = flag.Int("conn-burst", 10, "Set the connections an address can open at once.")
+	maxMessage  = flag.Int64("max-message", 4096, "Set the maximum size of a message, in bytes. 0 means unlimited.")
+	pingEvery   = flag.Int("ping", 20, "Set the time (in seconds) between pings to each connection. 0 means no pings.")
+	pingTimeout = flag.Int("ping-timeout", 60, "Set the time (in seconds) without an answer before a connection is dead. 0 means forever.")
+	reconnect   = flag.Int("reconnect-grace", 30, "Set the time (in seconds) a disconnected player has to reconnect before being out. 0 means until their turn.")
+	filterMode  = flag.String("filter-action", "reject", "Set what happens to content with disallowed words: reject, mask or flag.")
 )
 
 func main() {
 	flag.Parse()
-	srv := backend.NewServer(backend.Config{PlayerLimit: *playerLimit, Timeout: time.Duration(*timeout) * time.Second}, backend.StaticOP(), &backend.Rooms{})
+	store, ratingStore, accountStore, banStore := backend.MemoryStore(), backend.MemoryRatings(), backend.MemoryAccounts(), backend.MemoryBans()
+	if *database != "" {
+		db, err := backend.OpenBolt(*database)
+		if err != nil {
+			panic(err)
+		}
+		defer db.Close()
+		store, ratingStore, accountStore, banStore = db.Rooms(), db.Ratings(), db.Accounts(), db.Bans()
+	}
+	var mod *backend.Moderation
+	if *wordList != "" {
+		filter, err := backend.LoadWordList(*wordList)
+		if err != nil {
+			panic(err)
+		}
+		action, err := backend.ParseFilterAction(*filterMode)
+		if err != nil {
+			panic(err)
+		}
+		mod = &backend.Moderation{Filter: filter, Action: action}
+	}
+	limiter := backend.NewLimiter(backend.Limits{
+		MessageRate:    *msgRate,
+		MessageBurst:   *msgBurst,
+		IPMessageRate:  *ipMsgRate,
+		IPMessageBurst: *ipMsgBurst,
+		ConnectRate:    *connRate,
+		ConnectBurst:   *connBurst,
+		MaxMessageSize: *maxMessage,
+	})
+	heartbeat := backend.Heartbeat{
+		Interval: time.Duration(*pingEvery) * time.Second,
+		Timeout:  time.Duration(*pingTimeout) * time.Second,
+		Grace:    time.Duration(*reconnect) * time.Second,
+	}
+	ratings := &backend.Ratings{Store: ratingStore}
+	accounts := backend.NewAccounts(accountStore)
+	accounts.Moderation = mod
+	accounts.Limiter = limiter
+	leaderboard := backend.NewLeaderboard(ratings)
+	if err := leaderboard.Load(store); err != nil {
+		panic(err)
+	}
+	rooms := &backend.Rooms{Store: store, Grace: time.Duration(*grace) * time.Second, OnEnd: []func(backend.Room){ratings.Update, leaderboard.Record}, Accounts: accounts, Signer: backend.NewSigner([]byte(*secret), 24*time.Hour), Moderation: mod, Limiter: limiter, Heartbeat: heartbeat}
+	if err := rooms.Resume(); err != nil {
+		panic(err)
+	}
+	settings := backend.RoomSettings{
+		Timeout:        time.Duration(*timeout) * time.Second,
+		MinLength:      *minLength,
+		MaxLength:      *maxLength,
+		MaxWords:       *maxWords,
+		Punctuation:    *punctuation,
+		SingleSentence: *single,
+		MaxRounds:      *maxRounds,
+		WordBudget:     *wordBudget,
+		Duration:       time.Duration(*duration) * time.Second,
+		AllowedSkips:   *skips,
+		Category:       *category,
+		Spectators:     *spectators,
+		Voting:         *voting,
+		VoteTimeout:    time.Duration(*voteTimeout) * time.Second,
+		SpectatorVotes: *specVotes,
+	}
+	if err := settings.Validate(); err != nil {
+		panic(err)
+	}
+	config := backend.Config{PlayerLimit: *playerLimit, Settings: settings, RatingRange: *ratingRange, RatingWiden: *ratingWiden, Heartbeat: heartbeat}
+	if *modes != "" {
+		data, err := ioutil.ReadFile(*modes)
+		if err != nil {
+			panic(err)
+		}
+		if err := json.Unmarshal(data, &config.Modes); err != nil {
+			panic(err)
+		}
+		for name, mode := range config.Modes {
+			if err := mode.Validate(); err != nil {
+				panic(name + ": " + err.Error())
+			}
+		}
+	}
+	bans, err := backend.NewBans(banStore)
+	if err != nil {
+		panic(err)
+	}
+	var admin *backend.Admin
+	if *adminToken != "" {
+		admin = &backend.Admin{Token: *adminToken, Rooms: rooms, Bans: bans}
+	}
+	srv := backend.NewServer(config, backend.StaticOP(), rooms, backend.Services{
+		Ratings:     ratings,
+		Accounts:    accounts,
+		Moderation:  mod,
+		Bans:        bans,
+		Limiter:     limiter,
+		Admin:       admin,
+		Profiles:    &backend.Profiles{Store: store, Ratings: ratings, Accounts: accounts},
+		Leaderboard: leaderboard,
+	})
 	srv.Addr = ":80"
 	println("Ready!")
-	err := srv.ListenAndServe()
+	err = srv.ListenAndServe()
 	if err != nil {
 		panic(err)
 	}
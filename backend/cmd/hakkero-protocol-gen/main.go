@@ -0,0 +1,38 @@
+// Command hakkero-protocol-gen writes the JSON Schema and TypeScript definitions
+// of the Hakkero Project's wire protocol.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+
+	"github.com/natsukagami/hakkero-project/backend/protocol"
+)
+
+var (
+	schema     = flag.String("schema", "protocol/protocol.schema.json", "Set the path of the JSON Schema to write. If empty, it is not written.")
+	typeScript = flag.String("ts", "../frontend/src/protocol.d.ts", "Set the path of the TypeScript definitions to write, next to the JavaScript module they describe. If empty, they are not written.")
+)
+
+func main() {
+	flag.Parse()
+	if *schema != "" {
+		data, err := protocol.Schema()
+		if err != nil {
+			panic(err)
+		}
+		if err := ioutil.WriteFile(*schema, append(data, '\n'), 0644); err != nil {
+			panic(err)
+		}
+	}
+	if *typeScript != "" {
+		if err := ioutil.WriteFile(*typeScript, protocol.TypeScript(), 0644); err != nil {
+			panic(err)
+		}
+		module := strings.TrimSuffix(*typeScript, ".d.ts") + ".js"
+		if err := ioutil.WriteFile(module, protocol.JavaScript(), 0644); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -1,17 +1,71 @@
 package backend
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 // Config saves important game configurations.
 type Config struct {
-	PlayerLimit int
-	Timeout     time.Duration
+	PlayerLimit int                     // The maximum number of players in a room.
+	Settings    RoomSettings            // The settings of the default mode.
+	Modes       map[string]RoomSettings // The settings of other queue modes, by name.
+	RatingRange float64                 // The rating difference players accept within a match.
+	RatingWiden float64                 // The rating difference players additionally accept per second of waiting.
+	Heartbeat   Heartbeat               // The keep-alive setting of queue and lobby connections.
 }
 
-// DefaultConfig returns the default config.
-func DefaultConfig() Config {
-	return Config{
-		PlayerLimit: 4,
+// RoomSettings are the rules of a single game.
+// They are chosen per queue or per private lobby, and stored in the Room.
+type RoomSettings struct {
+	Timeout        time.Duration `json:"timeout"`        // The time of each turn.
+	MinLength      int           `json:"minLength"`      // The minimum length of a sentence, in characters.
+	MaxLength      int           `json:"maxLength"`      // The maximum length of a sentence, in characters. 0 means unlimited.
+	MaxWords       int           `json:"maxWords"`       // The maximum number of words in a sentence. 0 means unlimited.
+	Punctuation    bool          `json:"punctuation"`    // Whether sentences must end with a punctuation mark.
+	SingleSentence bool          `json:"singleSentence"` // Whether a turn must be exactly one sentence.
+	MaxRounds      int           `json:"maxRounds"`      // The number of rounds before the game ends. 0 means unlimited.
+	WordBudget     int           `json:"wordBudget"`     // The number of words in the story before the game ends. 0 means unlimited.
+	Duration       time.Duration `json:"duration"`       // The time before the game ends. 0 means unlimited.
+	AllowedSkips   int           `json:"allowedSkips"`   // The number of skips a player can make before being out.
+	Category       string        `json:"category"`       // The category of the opening sentence. Empty means any.
+	Spectators     bool          `json:"spectators"`     // Whether guests can watch the game.
+	Voting         bool          `json:"voting"`         // Whether the game ends with a vote for the best sentence or author.
+	VoteTimeout    time.Duration `json:"voteTimeout"`    // The time of the voting phase.
+	SpectatorVotes bool          `json:"spectatorVotes"` // Whether guests can vote too.
+}
+
+// DefaultSettings returns the default room settings.
+func DefaultSettings() RoomSettings {
+	return RoomSettings{
 		Timeout:     60 * time.Second,
+		MinLength:   1,
+		Spectators:  true,
+		VoteTimeout: 30 * time.Second,
+	}
+}
+
+// Validate checks whether the settings make a playable game.
+func (s RoomSettings) Validate() error {
+	switch {
+	case s.Timeout < 10*time.Second || s.Timeout > 10*time.Minute:
+		return errors.New("timeout must be between 10 seconds and 10 minutes")
+	case s.MinLength < 1:
+		return errors.New("minimum length must be positive")
+	case s.MaxLength != 0 && s.MaxLength < s.MinLength:
+		return errors.New("maximum length must not be less than the minimum length")
+	case s.MaxRounds < 0:
+		return errors.New("maximum rounds must not be negative")
+	case s.MaxWords < 0:
+		return errors.New("maximum words must not be negative")
+	case s.WordBudget < 0:
+		return errors.New("word budget must not be negative")
+	case s.Duration < 0 || s.Duration != 0 && s.Duration < s.Timeout:
+		return errors.New("duration must be zero, or at least one turn")
+	case s.AllowedSkips < 0:
+		return errors.New("allowed skips must not be negative")
+	case s.Voting && (s.VoteTimeout < 10*time.Second || s.VoteTimeout > 5*time.Minute):
+		return errors.New("vote timeout must be between 10 seconds and 5 minutes")
 	}
+	return nil
 }
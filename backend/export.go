@@ -0,0 +1,274 @@
+package backend
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// This file contains the story exporters, rendering a Room's sentences as a readable story.
+
+// storyLine is a line of the exported story.
+type storyLine struct {
+	Content string
+	Author  string // The username of the writer. Empty for the opening sentence and system announcements.
+	System  bool
+	Notes   []int // The numbers of the footnotes attached to this line.
+}
+
+// story is a Room, prepared for exporting.
+type story struct {
+	ID      int
+	Title   string
+	Authors []string
+	Date    time.Time
+	Lines   []storyLine
+	Notes   []string // The footnotes, numbered from 1.
+}
+
+// newStory prepares the Room for exporting.
+// If footnotes is set, system announcements are folded into footnotes of the previous line.
+func newStory(r Room, footnotes bool) story {
+	s := story{
+		ID:    r.ID,
+		Title: fmt.Sprintf("Hakkero Project - Room %d", r.ID),
+		Date:  r.Start,
+	}
+	for _, member := range r.Members {
+		s.Authors = append(s.Authors, member.Username)
+	}
+	for id, sent := range r.Sentences {
+		switch {
+		case id == 0:
+			// The opening sentence.
+			s.Lines = append(s.Lines, storyLine{Content: sent.Content})
+		case sent.System && footnotes:
+			s.Notes = append(s.Notes, sent.Content)
+			last := &s.Lines[len(s.Lines)-1]
+			last.Notes = append(last.Notes, len(s.Notes))
+		case sent.System:
+			s.Lines = append(s.Lines, storyLine{Content: sent.Content, System: true})
+		default:
+			s.Lines = append(s.Lines, storyLine{Content: sent.Content, Author: r.Members[sent.Owner].Username})
+		}
+	}
+	return s
+}
+
+// exporter renders a story into a file format.
+type exporter struct {
+	ContentType string
+	Extension   string
+	Render      func(w io.Writer, s story) error
+}
+
+var exporters = map[string]exporter{
+	"md":   {"text/markdown; charset=utf-8", "md", renderMarkdown},
+	"txt":  {"text/plain; charset=utf-8", "txt", renderText},
+	"html": {"text/html; charset=utf-8", "html", renderHTML},
+	"epub": {"application/epub+zip", "epub", renderEPUB},
+}
+
+func renderMarkdown(w io.Writer, s story) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n\n*Written by %s on %s.*\n\n", s.Title, strings.Join(s.Authors, ", "), s.Date.Format("January 2, 2006"))
+	for _, line := range s.Lines {
+		switch {
+		case line.System:
+			fmt.Fprintf(&b, "> %s", line.Content)
+		case line.Author == "":
+			fmt.Fprintf(&b, "**%s**", line.Content)
+		default:
+			fmt.Fprintf(&b, "%s — *%s*", line.Content, line.Author)
+		}
+		for _, note := range line.Notes {
+			fmt.Fprintf(&b, "[^%d]", note)
+		}
+		b.WriteString("\n\n")
+	}
+	for id, note := range s.Notes {
+		fmt.Fprintf(&b, "[^%d]: %s\n", id+1, note)
+	}
+	_, err := b.WriteTo(w)
+	return err
+}
+
+func renderText(w io.Writer, s story) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\nWritten by %s on %s.\n\n", s.Title, strings.Join(s.Authors, ", "), s.Date.Format("January 2, 2006"))
+	for _, line := range s.Lines {
+		switch {
+		case line.System:
+			fmt.Fprintf(&b, "  * %s", line.Content)
+		case line.Author == "":
+			b.WriteString(line.Content)
+		default:
+			fmt.Fprintf(&b, "%s (%s)", line.Content, line.Author)
+		}
+		for _, note := range line.Notes {
+			fmt.Fprintf(&b, " [%d]", note)
+		}
+		b.WriteString("\n")
+	}
+	if len(s.Notes) > 0 {
+		b.WriteString("\n")
+	}
+	for id, note := range s.Notes {
+		fmt.Fprintf(&b, "[%d] %s\n", id+1, note)
+	}
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// storyBody is the part of the HTML story shared with the EPUB export.
+const storyBody = `<h1>{{.Title}}</h1>
+<p class="byline"><em>Written by {{join .Authors ", "}} on {{.Date.Format "January 2, 2006"}}.</em></p>
+{{range .Lines}}<p{{if .System}} class="system"{{else if not .Author}} class="opening"{{end}}>{{if .System}}<em>{{.Content}}</em>{{else}}{{.Content}}{{end}}{{with .Author}} <span class="author">— {{.}}</span>{{end}}{{range .Notes}}<sup><a id="ref{{.}}" href="#note{{.}}">{{.}}</a></sup>{{end}}</p>
+{{end}}{{if .Notes}}<ol class="footnotes">
+{{range $id, $note := .Notes}}<li id="note{{inc $id}}">{{$note}} <a href="#ref{{inc $id}}">↩</a></li>
+{{end}}</ol>
+{{end}}`
+
+var storyFuncs = template.FuncMap{
+	"join": strings.Join,
+	"inc":  func(i int) int { return i + 1 },
+}
+
+var htmlTemplate = template.Must(template.New("html").Funcs(storyFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+` + storyBody + `</body>
+</html>
+`))
+
+func renderHTML(w io.Writer, s story) error {
+	return htmlTemplate.Execute(w, s)
+}
+
+var epubTemplate = template.Must(template.New("story.xhtml").Funcs(storyFuncs).Parse(`<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+<meta charset="utf-8" />
+<title>{{.Title}}</title>
+</head>
+<body>
+` + storyBody + `</body>
+</html>
+`))
+
+var epubNav = template.Must(template.New("nav.xhtml").Parse(`<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>{{.Title}}</title></head>
+<body>
+<nav epub:type="toc"><ol><li><a href="story.xhtml">{{.Title}}</a></li></ol></nav>
+</body>
+</html>
+`))
+
+var epubPackage = template.Must(template.New("content.opf").Funcs(storyFuncs).Parse(`<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="id">{{.Identifier}}</dc:identifier>
+<dc:title>{{.Title}}</dc:title>
+<dc:language>en</dc:language>
+{{range .Authors}}<dc:creator>{{.}}</dc:creator>
+{{end}}<meta property="dcterms:modified">{{.Modified}}</meta>
+</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+<item id="story" href="story.xhtml" media-type="application/xhtml+xml"/>
+</manifest>
+<spine><itemref idref="story"/></spine>
+</package>
+`))
+
+// xmlProlog is written before every EPUB file, as html/template would escape it.
+const xmlProlog = `<?xml version="1.0" encoding="utf-8"?>
+`
+
+const epubContainer = `<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>
+`
+
+func renderEPUB(w io.Writer, s story) error {
+	z := zip.NewWriter(w)
+	// The mimetype file must come first, uncompressed.
+	f, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte("application/epub+zip")); err != nil {
+		return err
+	}
+	// Each file is an XML document.
+	files := []struct {
+		name   string
+		render func(io.Writer) error
+	}{
+		{"META-INF/container.xml", func(w io.Writer) error { _, err := io.WriteString(w, epubContainer); return err }},
+		{"OEBPS/content.opf", func(w io.Writer) error {
+			return epubPackage.Execute(w, struct {
+				story
+				Identifier, Modified string
+			}{s, fmt.Sprintf("urn:hakkero:room:%d", s.ID), s.Date.UTC().Format("2006-01-02T15:04:05Z")})
+		}},
+		{"OEBPS/nav.xhtml", func(w io.Writer) error { return epubNav.Execute(w, s) }},
+		{"OEBPS/story.xhtml", func(w io.Writer) error { return epubTemplate.Execute(w, s) }},
+	}
+	for _, file := range files {
+		f, err := z.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, xmlProlog); err != nil {
+			return err
+		}
+		if err := file.render(f); err != nil {
+			return errors.Wrap(err, file.name)
+		}
+	}
+	return z.Close()
+}
+
+// serveExport renders the room's story in the requested format, if the visitor may follow the game.
+func (h *RoomHandler) serveExport(w http.ResponseWriter, r *http.Request, v visitor) {
+	if r.Method != "GET" {
+		w.WriteHeader(405)
+		return
+	}
+	if !h.visible(v) {
+		writeError(w, 403, errNoSpectators)
+		return
+	}
+	format := r.FormValue("format")
+	if format == "" {
+		format = "md"
+	}
+	e, ok := exporters[format]
+	if !ok {
+		w.WriteHeader(400)
+		w.Write([]byte("{\"error\": \"Unknown format\"}"))
+		return
+	}
+	footnotes := r.FormValue("footnotes") == "1" || r.FormValue("footnotes") == "true"
+	var b bytes.Buffer
+	if err := e.Render(&b, newStory(h.current(), footnotes)); err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte("{\"error\": \"Server error\"}"))
+		return
+	}
+	w.Header().Set("Content-Type", e.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"hakkero-room-%d.%s\"", h.Room.ID, e.Extension))
+	b.WriteTo(w)
+}
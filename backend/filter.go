@@ -0,0 +1,190 @@
+package backend
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ContentFilter finds disallowed words in user-written content.
+type ContentFilter interface {
+	// Filter returns the content with disallowed words masked, and whether any was found.
+	Filter(content string) (masked string, found bool)
+}
+
+// FilterAction is what happens to content a ContentFilter finds disallowed words in.
+type FilterAction int
+
+// FilterAction constants.
+const (
+	FilterReject FilterAction = iota // The content is refused.
+	FilterMask                       // The disallowed words are masked.
+	FilterFlag                       // The content is kept, but flagged for review.
+)
+
+// ParseFilterAction parses "reject", "mask" or "flag".
+func ParseFilterAction(s string) (FilterAction, error) {
+	switch s {
+	case "reject":
+		return FilterReject, nil
+	case "mask":
+		return FilterMask, nil
+	case "flag":
+		return FilterFlag, nil
+	}
+	return 0, fmt.Errorf("unknown filter action %q", s)
+}
+
+// ErrFiltered is returned when content is rejected by the content filter.
+var ErrFiltered = errors.New("the content contains disallowed words")
+
+// Moderation applies a ContentFilter with the configured action.
+// A nil Moderation lets everything through.
+type Moderation struct {
+	Filter ContentFilter
+	Action FilterAction
+}
+
+// Check applies the filter to the content. Rejected content returns ErrFiltered;
+// otherwise, it returns the content, masked if needed, and whether it is flagged for review.
+func (m *Moderation) Check(content string) (string, bool, error) {
+	if m == nil || m.Filter == nil {
+		return content, false, nil
+	}
+	masked, found := m.Filter.Filter(content)
+	if !found {
+		return content, false, nil
+	}
+	switch m.Action {
+	case FilterMask:
+		return masked, false, nil
+	case FilterFlag:
+		return content, true, nil
+	}
+	return "", false, ErrFiltered
+}
+
+// Username applies the filter to a username. Flagged usernames are logged,
+// and reported for review by the rooms they play in.
+func (m *Moderation) Username(username string) (string, error) {
+	username, flagged, err := m.Check(username)
+	if err != nil {
+		return "", errors.New("the username contains disallowed words")
+	}
+	if flagged {
+		log.Printf("Username %q flagged for review\n", username)
+	}
+	return username, nil
+}
+
+// leet maps the leetspeak symbols to the letters they stand for.
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'i', '+': 't',
+}
+
+// WordList is a ContentFilter matching whole words from a list,
+// seeing through leetspeak and repeated letters.
+type WordList struct {
+	words map[string]bool
+}
+
+// NewWordList returns a WordList of the given words.
+func NewWordList(words []string) *WordList {
+	wl := &WordList{words: make(map[string]bool)}
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			wl.words[unleet(w)] = true
+		}
+	}
+	return wl
+}
+
+// LoadWordList reads a WordList from a file with one word per line.
+// Empty lines and lines starting with '#' are ignored.
+func LoadWordList(path string) (*WordList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	return NewWordList(words), scanner.Err()
+}
+
+// Filter implements ContentFilter.
+func (wl *WordList) Filter(content string) (string, bool) {
+	runes := []rune(content)
+	found := false
+	for start := 0; start < len(runes); {
+		if !wordRune(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && wordRune(runes[end]) {
+			end++
+		}
+		if wl.match(string(runes[start:end])) {
+			found = true
+			for i := start; i < end; i++ {
+				runes[i] = '*'
+			}
+		}
+		start = end
+	}
+	return string(runes), found
+}
+
+// match checks a single word. Punctuation around the word is tried both
+// as leetspeak ("$hit") and as punctuation ("damn!").
+func (wl *WordList) match(word string) bool {
+	trimmed := strings.TrimFunc(word, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	for _, w := range []string{word, trimmed} {
+		w = unleet(w)
+		if wl.words[w] || wl.words[squeeze(w)] {
+			return true
+		}
+	}
+	return false
+}
+
+// wordRune returns whether the rune can be part of a word.
+func wordRune(r rune) bool {
+	_, ok := leet[r]
+	return ok || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// unleet lowercases the word and replaces leetspeak symbols with letters.
+func unleet(word string) string {
+	return strings.Map(func(r rune) rune {
+		if l, ok := leet[r]; ok {
+			return l
+		}
+		return unicode.ToLower(r)
+	}, word)
+}
+
+// squeeze collapses runs of the same letter, so that "baaad" matches "bad".
+// Only content is squeezed, not the list, so that words with double letters still match exactly.
+func squeeze(word string) string {
+	var b strings.Builder
+	last := rune(-1)
+	for _, r := range word {
+		if r != last {
+			b.WriteRune(r)
+		}
+		last = r
+	}
+	return b.String()
+}
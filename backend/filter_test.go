@@ -0,0 +1,76 @@
+package backend
+
+import "testing"
+
+func TestWordListFilter(t *testing.T) {
+	wl := NewWordList([]string{"bad", "  shit ", "", "ass"})
+	tests := []struct {
+		name    string
+		content string
+		masked  string
+		found   bool
+	}{
+		{"clean", "A good story.", "A good story.", false},
+		{"whole word", "A bad story.", "A *** story.", true},
+		{"case", "A BaD story.", "A *** story.", true},
+		{"inside a word", "Badminton is fun.", "Badminton is fun.", false},
+		{"leetspeak", "A b4d story.", "A *** story.", true},
+		{"leet symbol prefix", "Oh $hit.", "Oh ****.", true},
+		{"trailing punctuation", "Bad!", "****", true},
+		{"repeated letters", "A baaaad story.", "A ****** story.", true},
+		{"double letters in the list", "An ass.", "An ***.", true},
+		{"squeezed double letters", "An as.", "An as.", false},
+		{"several", "Bad, bad shit.", "***, *** ****.", true},
+		{"non-latin", "Ein bäd Tag.", "Ein bäd Tag.", false},
+	}
+	for _, tt := range tests {
+		masked, found := wl.Filter(tt.content)
+		if masked != tt.masked || found != tt.found {
+			t.Errorf("%s: Filter(%q) = %q, %v; want %q, %v", tt.name, tt.content, masked, found, tt.masked, tt.found)
+		}
+	}
+}
+
+func TestModerationCheck(t *testing.T) {
+	wl := NewWordList([]string{"bad"})
+	tests := []struct {
+		name    string
+		m       *Moderation
+		content string
+		want    string
+		flagged bool
+		err     error
+	}{
+		{"nil", nil, "A bad story.", "A bad story.", false, nil},
+		{"no filter", &Moderation{Action: FilterReject}, "A bad story.", "A bad story.", false, nil},
+		{"clean", &Moderation{Filter: wl, Action: FilterReject}, "A good story.", "A good story.", false, nil},
+		{"reject", &Moderation{Filter: wl, Action: FilterReject}, "A bad story.", "", false, ErrFiltered},
+		{"mask", &Moderation{Filter: wl, Action: FilterMask}, "A bad story.", "A *** story.", false, nil},
+		{"flag", &Moderation{Filter: wl, Action: FilterFlag}, "A bad story.", "A bad story.", true, nil},
+	}
+	for _, tt := range tests {
+		got, flagged, err := tt.m.Check(tt.content)
+		if got != tt.want || flagged != tt.flagged || err != tt.err {
+			t.Errorf("%s: Check(%q) = %q, %v, %v; want %q, %v, %v", tt.name, tt.content, got, flagged, err, tt.want, tt.flagged, tt.err)
+		}
+	}
+}
+
+func TestParseFilterAction(t *testing.T) {
+	tests := []struct {
+		s      string
+		action FilterAction
+		ok     bool
+	}{
+		{"reject", FilterReject, true},
+		{"mask", FilterMask, true},
+		{"flag", FilterFlag, true},
+		{"ban", 0, false},
+	}
+	for _, tt := range tests {
+		action, err := ParseFilterAction(tt.s)
+		if action != tt.action || (err == nil) != tt.ok {
+			t.Errorf("ParseFilterAction(%q) = %v, %v; want %v, ok = %v", tt.s, action, err, tt.action, tt.ok)
+		}
+	}
+}
@@ -1,6 +1,13 @@
 module github.com/natsukagami/hakkero-project/backend
 
+go 1.22
+
 require (
 	github.com/gorilla/websocket v1.4.0
 	github.com/pkg/errors v0.8.1
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/crypto v0.31.0
+	golang.org/x/text v0.21.0
 )
+
+require golang.org/x/sys v0.28.0 // indirect
@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Heartbeat is the keep-alive setting of connections.
+type Heartbeat struct {
+	Interval time.Duration // The time between pings. 0 means no pings.
+	Timeout  time.Duration // The time without a message or a pong before a connection is dead. 0 means forever.
+	// The time a disconnected player has to reconnect before being out of the game.
+	// 0 means they are only out once their turn comes.
+	Grace time.Duration
+}
+
+// DefaultHeartbeat returns the default heartbeat.
+func DefaultHeartbeat() Heartbeat {
+	return Heartbeat{
+		Interval: 20 * time.Second,
+		Timeout:  60 * time.Second,
+		Grace:    30 * time.Second,
+	}
+}
+
+// keepAlive sets the connection up to be pinged, and to die when the client stops answering.
+// It must be called before reading starts.
+func (p *Conn) keepAlive(hb Heartbeat) {
+	p.timeout = hb.Timeout
+	p.extend()
+	p.SetPongHandler(func(string) error {
+		p.extend()
+		return nil
+	})
+	if hb.Interval > 0 {
+		go p.ping(hb.Interval)
+	}
+}
+
+// extend pushes the read deadline back, as the client is still alive.
+func (p *Conn) extend() {
+	if p.timeout > 0 {
+		p.SetReadDeadline(time.Now().Add(p.timeout))
+	}
+}
+
+// ping pings the client every interval, until the connection fails.
+func (p *Conn) ping(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Ping(time.Now().Add(interval)); err != nil {
+				p.broadcastError(errors.Wrap(err, "playerconn ping"))
+				return
+			}
+		case <-p.ErrChan:
+			return
+		}
+	}
+}
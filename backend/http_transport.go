@@ -0,0 +1,376 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/natsukagami/hakkero-project/backend/protocol"
+)
+
+const (
+	pollWait    = 25 * time.Second // The longest time a poll waits for messages.
+	sessionIdle = time.Minute      // The time a polled session lives without polls, and a closed session is kept.
+	streamWait  = 10 * time.Second // The longest time writing to an event stream can take.
+	maxPending  = 1024             // The messages kept for a client that does not fetch them.
+)
+
+// HTTP session errors.
+var (
+	errSessionClosed  = errors.New("session closed")
+	errSessionTimeout = errors.New("session read timeout")
+)
+
+// httpAddr is the address of an HTTP client.
+type httpAddr string
+
+func (a httpAddr) Network() string { return "tcp" }
+func (a httpAddr) String() string  { return string(a) }
+
+// httpTransport is a Transport over plain HTTP. Messages are either streamed as
+// Server-Sent Events, or fetched by long-polling, and the client POSTs its own.
+type httpTransport struct {
+	id        string
+	addr      httpAddr
+	stream    bool        // Whether messages are streamed, rather than polled.
+	in        chan []byte // The client's messages.
+	closed    chan struct{}
+	closeOnce sync.Once
+	idle      *time.Timer // Closes polled sessions once polls stop.
+
+	mu       sync.Mutex
+	pending  [][]byte      // The messages not fetched yet, in order. Nil messages are pings.
+	ready    chan struct{} // Signalled when pending is no longer empty.
+	deadline time.Time
+	limit    int64
+	pong     func(string) error
+	closing  *protocol.SessionClosed
+}
+
+// sessionMap keeps the open HTTP sessions.
+type sessionMap struct {
+	mu sync.Mutex
+	m  map[string]*httpTransport
+}
+
+// sessions are the HTTP sessions of every handler, served under /transport/.
+var sessions = &sessionMap{m: make(map[string]*httpTransport)}
+
+// open opens a session for the request's client.
+func (s *sessionMap) open(r *http.Request, stream bool) *httpTransport {
+	t := &httpTransport{
+		id:     randToken(),
+		addr:   httpAddr(r.RemoteAddr),
+		stream: stream,
+		in:     make(chan []byte),
+		closed: make(chan struct{}),
+		ready:  make(chan struct{}, 1),
+	}
+	if !stream {
+		t.idle = time.AfterFunc(sessionIdle, func() { t.CloseWith(websocket.CloseGoingAway, "session expired") })
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[t.id] = t
+	return t
+}
+
+func (s *sessionMap) get(id string) (*httpTransport, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.m[id]
+	return t, ok
+}
+
+func (s *sessionMap) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, id)
+}
+
+// ServeHTTP serves /transport/{session}: clients GET it to poll, and POST their messages to it.
+func (s *sessionMap) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.WriteHeader(204)
+		return
+	}
+	t, ok := s.get(strings.TrimPrefix(r.URL.Path, "/transport/"))
+	if !ok {
+		writeError(w, 404, errors.New("no such session"))
+		return
+	}
+	switch {
+	case r.Method == "POST":
+		t.serveSend(w, r)
+	case r.Method == "GET" && !t.stream:
+		t.servePoll(w, r)
+	default:
+		w.WriteHeader(405)
+	}
+}
+
+// push queues a message for the client.
+func (t *httpTransport) push(data []byte) error {
+	t.mu.Lock()
+	if t.isClosed() {
+		t.mu.Unlock()
+		return errSessionClosed
+	}
+	if len(t.pending) >= maxPending {
+		t.mu.Unlock()
+		t.CloseWith(websocket.CloseTryAgainLater, "too many messages pending")
+		return errSessionClosed
+	}
+	t.pending = append(t.pending, data)
+	t.mu.Unlock()
+	select {
+	case t.ready <- struct{}{}:
+	default: // Already signalled.
+	}
+	return nil
+}
+
+// take returns the pending messages, and the close information if the session is over.
+func (t *httpTransport) take() ([][]byte, *protocol.SessionClosed) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pending := t.pending
+	t.pending = nil
+	if !t.isClosed() {
+		return pending, nil
+	}
+	if t.closing == nil {
+		return pending, &protocol.SessionClosed{Code: websocket.CloseNormalClosure}
+	}
+	return pending, t.closing
+}
+
+func (t *httpTransport) isClosed() bool {
+	select {
+	case <-t.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// alive tells the heartbeat that the client is still there.
+func (t *httpTransport) alive() {
+	t.mu.Lock()
+	pong := t.pong
+	t.mu.Unlock()
+	if pong != nil {
+		pong("")
+	}
+}
+
+// WriteJSON queues the message for the client.
+func (t *httpTransport) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return t.push(data)
+}
+
+// ReadJSON waits for the client's next message.
+func (t *httpTransport) ReadJSON(v interface{}) error {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		t.mu.Lock()
+		deadline := t.deadline
+		t.mu.Unlock()
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer.Stop()
+			timer.Reset(time.Until(deadline))
+			timeout = timer.C
+		}
+		select {
+		case data := <-t.in:
+			return json.Unmarshal(data, v)
+		case <-t.closed:
+			return errSessionClosed
+		case <-timeout:
+		}
+		// The deadline may have been pushed back meanwhile.
+		t.mu.Lock()
+		expired := !t.deadline.After(time.Now())
+		t.mu.Unlock()
+		if expired {
+			t.CloseWith(websocket.CloseGoingAway, "timed out")
+			return errSessionTimeout
+		}
+	}
+}
+
+// SetReadDeadline sets the time ReadJSON gives up waiting.
+func (t *httpTransport) SetReadDeadline(deadline time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.deadline = deadline
+	return nil
+}
+
+// SetReadLimit sets the maximum size of the client's messages.
+func (t *httpTransport) SetReadLimit(limit int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limit = limit
+}
+
+// SetPongHandler sets the function called while the client is fetching messages.
+func (t *httpTransport) SetPongHandler(h func(appData string) error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pong = h
+}
+
+// Ping checks the event stream. Polled sessions are checked by the polls themselves.
+func (t *httpTransport) Ping(deadline time.Time) error {
+	if !t.stream {
+		return nil
+	}
+	return t.push(nil)
+}
+
+// CloseWith closes the session, telling the client why once it has fetched every message.
+func (t *httpTransport) CloseWith(code int, reason string) error {
+	t.mu.Lock()
+	if t.closing == nil {
+		t.closing = &protocol.SessionClosed{Code: code, Reason: reason}
+	}
+	t.mu.Unlock()
+	return t.Close()
+}
+
+// Close closes the session. It is kept for a while, so that the client can fetch the last messages.
+func (t *httpTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		if t.idle != nil {
+			t.idle.Stop()
+		}
+		time.AfterFunc(sessionIdle, func() { sessions.remove(t.id) })
+	})
+	return nil
+}
+
+// RemoteAddr returns the address of the client that opened the session.
+func (t *httpTransport) RemoteAddr() net.Addr {
+	return t.addr
+}
+
+// serveSend passes the POSTed message on to the reader.
+func (t *httpTransport) serveSend(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	limit := t.limit
+	t.mu.Unlock()
+	if limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		t.CloseWith(websocket.CloseMessageTooBig, "message too big")
+		writeError(w, 413, err)
+		return
+	}
+	if err != nil {
+		writeError(w, 400, err)
+		return
+	}
+	select {
+	case t.in <- data:
+		w.WriteHeader(204)
+	case <-t.closed:
+		writeError(w, 410, errSessionClosed)
+	case <-r.Context().Done():
+	}
+}
+
+// servePoll answers a poll with the pending messages, waiting for some if there are none.
+func (t *httpTransport) servePoll(w http.ResponseWriter, r *http.Request) {
+	if t.idle != nil {
+		t.idle.Reset(sessionIdle)
+	}
+	t.alive()
+	timer := time.NewTimer(pollWait)
+	defer timer.Stop()
+	select {
+	case <-t.ready:
+	case <-t.closed:
+	case <-timer.C:
+	case <-r.Context().Done():
+		return
+	}
+	pending, closing := t.take()
+	res := protocol.PollResponse{Session: t.id, Messages: make([]json.RawMessage, 0, len(pending)), Closed: closing}
+	for _, data := range pending {
+		if data != nil {
+			res.Messages = append(res.Messages, data)
+		}
+	}
+	writeJSON(w, 200, res)
+}
+
+// serveStream streams the messages as Server-Sent Events, until the session closes or the client leaves.
+// The stream opens with a protocol.EventSession event, and ends with a protocol.EventClose one.
+func (t *httpTransport) serveStream(w http.ResponseWriter, r *http.Request) {
+	defer t.Close()
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	write := func(format string, args ...interface{}) error {
+		rc.SetWriteDeadline(time.Now().Add(streamWait))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	session, _ := json.Marshal(protocol.Session{Session: t.id})
+	if err := write("event: %s\ndata: %s\n\n", protocol.EventSession, session); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-t.ready:
+		case <-t.closed:
+		case <-r.Context().Done():
+			return
+		}
+		pending, closing := t.take()
+		pinged := false
+		for _, data := range pending {
+			var err error
+			if data == nil {
+				pinged = true
+				err = write(": ping\n\n")
+			} else {
+				err = write("data: %s\n\n", data)
+			}
+			if err != nil {
+				return
+			}
+		}
+		if pinged {
+			t.alive()
+		}
+		if closing != nil {
+			data, _ := json.Marshal(closing)
+			write("event: %s\ndata: %s\n\n", protocol.EventClose, data)
+			return
+		}
+	}
+}
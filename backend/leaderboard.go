@@ -0,0 +1,236 @@
+package backend
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Leaderboard metrics and periods.
+const (
+	MetricWins      = "wins"
+	MetricRating    = "rating"
+	MetricSentences = "sentences"
+
+	PeriodDay  = "day"
+	PeriodWeek = "week"
+	PeriodAll  = "all"
+)
+
+// leaderboardDays is the number of daily tallies kept, enough for a week.
+const leaderboardDays = 7
+
+// tally is a player's results over a period.
+type tally struct {
+	Wins      int
+	Sentences int
+}
+
+// LeaderboardEntry is a line of the leaderboard.
+type LeaderboardEntry struct {
+	Rank     int     `json:"rank"`
+	Username string  `json:"username"`
+	Value    float64 `json:"value"`
+}
+
+// Leaderboard ranks the players. It is updated as games end, keeping a tally
+// of all time and one for each of the last days.
+type Leaderboard struct {
+	Ratings *Ratings // If nil, the rating metric is not available.
+	mu      sync.Mutex
+	all     map[string]*tally
+	days    map[int64]map[string]*tally // Keyed by the number of days since the Unix epoch.
+}
+
+// NewLeaderboard returns an empty leaderboard.
+func NewLeaderboard(ratings *Ratings) *Leaderboard {
+	return &Leaderboard{
+		Ratings: ratings,
+		all:     make(map[string]*tally),
+		days:    make(map[int64]map[string]*tally),
+	}
+}
+
+func dayOf(t time.Time) int64 {
+	return t.Unix() / int64(24*time.Hour/time.Second)
+}
+
+// Load records every finished game in the store. It should be called once, on startup.
+// Games that ended without their results being recorded are left to Rooms.Resume, which finishes them.
+func (lb *Leaderboard) Load(store RoomStore) error {
+	return store.Each(func(r Room) error {
+		if len(r.Members) > 0 && r.Finished {
+			lb.Record(r)
+		}
+		return nil
+	})
+}
+
+// Record adds a finished game's results. Only registered members are ranked.
+func (lb *Leaderboard) Record(r Room) {
+	end := r.Current
+	if end.IsZero() {
+		end = r.Start
+	}
+	day := dayOf(end)
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if _, ok := lb.days[day]; !ok {
+		lb.days[day] = make(map[string]*tally)
+		// Forget about the days that are too old.
+		for d := range lb.days {
+			if d <= dayOf(time.Now())-leaderboardDays {
+				delete(lb.days, d)
+			}
+		}
+	}
+	winner := r.Winner()
+	for id, member := range r.Members {
+		if !member.Registered {
+			// Anyone can play under an unregistered username.
+			continue
+		}
+		var t tally
+		if id == winner {
+			t.Wins++
+		}
+		for _, sent := range r.Sentences {
+			if !sent.System && sent.Owner == id {
+				t.Sentences++
+			}
+		}
+		for _, tallies := range []map[string]*tally{lb.all, lb.days[day]} {
+			if tallies == nil {
+				// The game is too old for the daily tallies.
+				continue
+			}
+			if tallies[member.Username] == nil {
+				tallies[member.Username] = &tally{}
+			}
+			tallies[member.Username].Wins += t.Wins
+			tallies[member.Username].Sentences += t.Sentences
+		}
+	}
+}
+
+// period returns the tallies of the period.
+// It must be called with the lock held.
+func (lb *Leaderboard) period(period string) (map[string]*tally, error) {
+	days := 0
+	switch period {
+	case PeriodAll:
+		return lb.all, nil
+	case PeriodDay:
+		days = 1
+	case PeriodWeek:
+		days = leaderboardDays
+	default:
+		return nil, errors.New("unknown period")
+	}
+	sum := make(map[string]*tally)
+	today := dayOf(time.Now())
+	for d := today - int64(days) + 1; d <= today; d++ {
+		for name, t := range lb.days[d] {
+			if sum[name] == nil {
+				sum[name] = &tally{}
+			}
+			sum[name].Wins += t.Wins
+			sum[name].Sentences += t.Sentences
+		}
+	}
+	return sum, nil
+}
+
+// Top returns the ranking of the metric over the period, along with the number of ranked players.
+// Only the entries from offset, up to limit of them, are returned.
+func (lb *Leaderboard) Top(metric, period string, offset, limit int) ([]LeaderboardEntry, int, error) {
+	lb.mu.Lock()
+	tallies, err := lb.period(period)
+	if err != nil {
+		lb.mu.Unlock()
+		return nil, 0, err
+	}
+	entries := make([]LeaderboardEntry, 0, len(tallies))
+	for name, t := range tallies {
+		entries = append(entries, LeaderboardEntry{Username: name, Value: float64(t.Wins)})
+		if metric == MetricSentences {
+			entries[len(entries)-1].Value = float64(t.Sentences)
+		}
+	}
+	lb.mu.Unlock()
+	switch metric {
+	case MetricWins, MetricSentences:
+	case MetricRating:
+		if lb.Ratings == nil {
+			return nil, 0, errors.New("ratings are not available")
+		}
+		// Ratings are current, the period only selects who is ranked.
+		for id := range entries {
+			entries[id].Value = lb.Ratings.Get(entries[id].Username).Value
+		}
+	default:
+		return nil, 0, errors.New("unknown metric")
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Value != entries[j].Value {
+			return entries[i].Value > entries[j].Value
+		}
+		return entries[i].Username < entries[j].Username
+	})
+	for id := range entries {
+		entries[id].Rank = id + 1
+		if id > 0 && entries[id].Value == entries[id-1].Value {
+			entries[id].Rank = entries[id-1].Rank
+		}
+	}
+	total := len(entries)
+	if offset < 0 || offset > total {
+		offset = total
+	}
+	if limit < total-offset {
+		entries = entries[:offset+limit]
+	}
+	return entries[offset:], total, nil
+}
+
+// ServeHTTP serves /leaderboard?metric=...&period=...&page=...&limit=...
+func (lb *Leaderboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	metric, period := r.FormValue("metric"), r.FormValue("period")
+	if metric == "" {
+		metric = MetricWins
+	}
+	if period == "" {
+		period = PeriodAll
+	}
+	page, err := strconv.Atoi(r.FormValue("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+	// Pages too far for their offset to fit are past the end of the ranking.
+	offset := math.MaxInt
+	if page-1 <= math.MaxInt/limit {
+		offset = (page - 1) * limit
+	}
+	entries, total, err := lb.Top(metric, period, offset, limit)
+	if err != nil {
+		writeError(w, 400, err)
+		return
+	}
+	writeJSON(w, 200, map[string]interface{}{
+		"metric":  metric,
+		"period":  period,
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+		"entries": entries,
+	})
+}
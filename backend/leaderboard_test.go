@@ -0,0 +1,150 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// finishedGame returns a finished game that ended at the given time, won by the member at winner,
+// where each member wrote the given number of sentences.
+func finishedGame(end time.Time, winner int, members []User, sentences []int) Room {
+	r := Room{Members: members, Start: end.Add(-time.Hour), Current: end, Finished: true}
+	r.Sentences = append(r.Sentences, Sentence{Content: "Once upon a time.", System: true})
+	for id := range members {
+		st := StatusOut
+		if id == winner {
+			st = StatusActive
+		}
+		r.Status = append(r.Status, st)
+		for i := 0; i < sentences[id]; i++ {
+			r.Sentences = append(r.Sentences, Sentence{Content: "And then.", Owner: id})
+		}
+	}
+	return r
+}
+
+func testLeaderboard() *Leaderboard {
+	alice := User{ID: "a", Username: "alice", Registered: true}
+	bob := User{ID: "b", Username: "bob", Registered: true}
+	carol := User{ID: "c", Username: "carol", Registered: true}
+	guest := User{ID: "g", Username: "guest"}
+
+	ratings := MemoryRatings()
+	ratings.Put(0, map[string]Rating{"alice": {1600, 1}, "carol": {1550, 1}})
+	lb := NewLeaderboard(&Ratings{Store: ratings})
+	now := time.Now()
+	lb.Record(finishedGame(now, 0, []User{alice, bob}, []int{2, 1}))
+	lb.Record(finishedGame(now.Add(-3*24*time.Hour), 1, []User{bob, carol}, []int{1, 3}))
+	lb.Record(finishedGame(now.Add(-10*24*time.Hour), 0, []User{carol, alice}, []int{1, 0}))
+	lb.Record(finishedGame(now, 0, []User{guest, alice}, []int{5, 1}))
+	return lb
+}
+
+// formatEntries formats the entries as "rank:username:value".
+func formatEntries(entries []LeaderboardEntry) string {
+	s := ""
+	for _, e := range entries {
+		s += fmt.Sprintf("%d:%s:%g ", e.Rank, e.Username, e.Value)
+	}
+	return s
+}
+
+func TestLeaderboardTop(t *testing.T) {
+	lb := testLeaderboard()
+	tests := []struct {
+		name          string
+		metric        string
+		period        string
+		offset, limit int
+		want          string
+		total         int
+	}{
+		{"wins of all time", MetricWins, PeriodAll, 0, 10, "1:carol:2 2:alice:1 3:bob:0 ", 3},
+		{"wins of the week", MetricWins, PeriodWeek, 0, 10, "1:alice:1 1:carol:1 3:bob:0 ", 3},
+		{"wins of the day", MetricWins, PeriodDay, 0, 10, "1:alice:1 2:bob:0 ", 2},
+		{"sentences of all time", MetricSentences, PeriodAll, 0, 10, "1:carol:4 2:alice:3 3:bob:2 ", 3},
+		{"sentences of the day", MetricSentences, PeriodDay, 0, 10, "1:alice:3 2:bob:1 ", 2},
+		{"rating of the day", MetricRating, PeriodDay, 0, 10, "1:alice:1600 2:bob:1500 ", 2},
+		{"rating of all time", MetricRating, PeriodAll, 0, 10, "1:alice:1600 2:carol:1550 3:bob:1500 ", 3},
+		{"second page", MetricWins, PeriodAll, 1, 1, "2:alice:1 ", 3},
+		{"last page", MetricWins, PeriodAll, 2, 2, "3:bob:0 ", 3},
+		{"past the end", MetricWins, PeriodAll, 3, 2, "", 3},
+		{"huge offset", MetricWins, PeriodAll, math.MaxInt, 20, "", 3},
+		{"negative offset", MetricWins, PeriodAll, -1, 20, "", 3},
+		{"huge limit", MetricWins, PeriodAll, 1, math.MaxInt, "2:alice:1 3:bob:0 ", 3},
+	}
+	for _, tt := range tests {
+		entries, total, err := lb.Top(tt.metric, tt.period, tt.offset, tt.limit)
+		if err != nil {
+			t.Errorf("%s: Top() error: %v", tt.name, err)
+			continue
+		}
+		if got := formatEntries(entries); got != tt.want || total != tt.total {
+			t.Errorf("%s: Top() = %q, %d; want %q, %d", tt.name, got, total, tt.want, tt.total)
+		}
+	}
+}
+
+func TestLeaderboardTopErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		lb     *Leaderboard
+		metric string
+		period string
+	}{
+		{"unknown metric", testLeaderboard(), "losses", PeriodAll},
+		{"unknown period", testLeaderboard(), MetricWins, "month"},
+		{"no ratings", NewLeaderboard(nil), MetricRating, PeriodAll},
+	}
+	for _, tt := range tests {
+		if _, _, err := tt.lb.Top(tt.metric, tt.period, 0, 10); err == nil {
+			t.Errorf("%s: Top() succeeded; want an error", tt.name)
+		}
+	}
+}
+
+func TestLeaderboardServeHTTP(t *testing.T) {
+	lb := testLeaderboard()
+	tests := []struct {
+		name  string
+		query string
+		code  int
+		page  int
+		limit int
+		want  string
+	}{
+		{"defaults", "", 200, 1, 20, "1:carol:2 2:alice:1 3:bob:0 "},
+		{"paged", "?page=2&limit=2", 200, 2, 2, "3:bob:0 "},
+		{"invalid page", "?page=-3&limit=2", 200, 1, 2, "1:carol:2 2:alice:1 "},
+		{"limit too large", "?limit=1000", 200, 1, 20, "1:carol:2 2:alice:1 3:bob:0 "},
+		{"huge page", "?page=9223372036854775807&limit=100", 200, math.MaxInt, 100, ""},
+		{"unknown metric", "?metric=losses", 400, 0, 0, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		lb.ServeHTTP(w, httptest.NewRequest("GET", "/leaderboard"+tt.query, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d; want %d", tt.name, w.Code, tt.code)
+			continue
+		}
+		if w.Code != 200 {
+			continue
+		}
+		var resp struct {
+			Page    int                `json:"page"`
+			Limit   int                `json:"limit"`
+			Entries []LeaderboardEntry `json:"entries"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Errorf("%s: invalid response: %v", tt.name, err)
+			continue
+		}
+		if got := formatEntries(resp.Entries); resp.Page != tt.page || resp.Limit != tt.limit || got != tt.want {
+			t.Errorf("%s: page %d, limit %d, entries %q; want %d, %d, %q", tt.name, resp.Page, resp.Limit, got, tt.page, tt.limit, tt.want)
+		}
+	}
+}
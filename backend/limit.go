@@ -0,0 +1,182 @@
+package backend
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTooManyConnections is returned when an address opens connections too fast.
+var ErrTooManyConnections = errors.New("too many connections, please slow down")
+
+// Limits are the flood protection settings. Zero rates mean unlimited.
+type Limits struct {
+	MessageRate    float64 // The messages per second a connection can send, on average.
+	MessageBurst   int     // The messages a connection can send at once.
+	IPMessageRate  float64 // The messages per second all connections of an address can send, on average.
+	IPMessageBurst int     // The messages all connections of an address can send at once.
+	ConnectRate    float64 // The connections per second an address can open, on average.
+	ConnectBurst   int     // The connections an address can open at once.
+	MaxMessageSize int64   // The maximum size of a message, in bytes. 0 means unlimited.
+}
+
+// DefaultLimits returns the default limits.
+func DefaultLimits() Limits {
+	return Limits{
+		MessageRate:    2,
+		MessageBurst:   10,
+		IPMessageRate:  10,
+		IPMessageBurst: 30,
+		ConnectRate:    1,
+		ConnectBurst:   10,
+		MaxMessageSize: 4096,
+	}
+}
+
+// bucket is a token bucket. A nil bucket is unlimited.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newBucket returns a full bucket, or nil if the rate is unlimited.
+func newBucket(rate float64, burst int) *bucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// allow takes a token, returning false if there is none.
+func (b *bucket) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// ipBuckets are the buckets shared by all connections of an address.
+type ipBuckets struct {
+	connect *bucket
+	message *bucket
+	seen    time.Time
+	conns   int // The live connections sharing the message bucket.
+}
+
+// Limiter enforces the Limits, keeping the buckets of every address.
+// A nil Limiter lets everything through.
+type Limiter struct {
+	Limits Limits
+	mu     sync.Mutex
+	ips    map[string]*ipBuckets
+}
+
+// NewLimiter returns a new Limiter enforcing the limits.
+func NewLimiter(l Limits) *Limiter {
+	lim := &Limiter{Limits: l, ips: make(map[string]*ipBuckets)}
+	go lim.sweep()
+	return lim
+}
+
+// sweep periodically forgets the addresses that have been quiet for a while.
+// Addresses with live connections are kept, so that new connections share their message bucket.
+func (l *Limiter) sweep() {
+	for now := range time.Tick(time.Minute) {
+		l.mu.Lock()
+		for ip, b := range l.ips {
+			if b.conns == 0 && now.Sub(b.seen) > 10*time.Minute {
+				delete(l.ips, ip)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// get returns the buckets of the address.
+func (l *Limiter) get(ip string) *ipBuckets {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.ips[ip]
+	if !ok {
+		b = &ipBuckets{
+			connect: newBucket(l.Limits.ConnectRate, l.Limits.ConnectBurst),
+			message: newBucket(l.Limits.IPMessageRate, l.Limits.IPMessageBurst),
+		}
+		l.ips[ip] = b
+	}
+	b.seen = time.Now()
+	return b
+}
+
+// Connect returns ErrTooManyConnections if the address cannot open a new connection yet.
+func (l *Limiter) Connect(ip string) error {
+	if l == nil || l.get(ip).connect.allow(time.Now()) {
+		return nil
+	}
+	return ErrTooManyConnections
+}
+
+// Conn applies the limits to a new connection from the address.
+// The returned ConnLimit is to be given to the connection's constructor,
+// which releases it once the connection is over.
+func (l *Limiter) Conn(t Transport, ip string) *ConnLimit {
+	if l == nil {
+		return nil
+	}
+	if l.Limits.MaxMessageSize > 0 {
+		t.SetReadLimit(l.Limits.MaxMessageSize)
+	}
+	b := l.get(ip)
+	l.mu.Lock()
+	b.conns++
+	l.mu.Unlock()
+	return &ConnLimit{
+		conn: newBucket(l.Limits.MessageRate, l.Limits.MessageBurst),
+		ip:   b,
+		l:    l,
+	}
+}
+
+// ConnLimit is the message limit of a connection. A nil ConnLimit is unlimited.
+type ConnLimit struct {
+	conn    *bucket
+	ip      *ipBuckets
+	l       *Limiter
+	release sync.Once
+}
+
+// allow takes a token for an incoming message, returning false if the connection is flooding.
+func (c *ConnLimit) allow() bool {
+	if c == nil {
+		return true
+	}
+	now := time.Now()
+	return c.conn.allow(now) && c.ip.message.allow(now)
+}
+
+// done releases the address's buckets, once the connection is over.
+func (c *ConnLimit) done() {
+	if c == nil {
+		return
+	}
+	c.release.Do(func() {
+		c.l.mu.Lock()
+		defer c.l.mu.Unlock()
+		c.ip.conns--
+		c.ip.seen = time.Now()
+	})
+}
@@ -0,0 +1,96 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketAllow(t *testing.T) {
+	start := time.Now()
+	type take struct {
+		at   time.Duration // Since the bucket was filled.
+		want bool
+	}
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		takes []take
+	}{
+		{"unlimited", 0, 0, []take{{0, true}, {0, true}, {0, true}}},
+		{"burst", 1, 2, []take{{0, true}, {0, true}, {0, false}}},
+		{"refill", 1, 2, []take{{0, true}, {0, true}, {0, false}, {time.Second, true}, {time.Second, false}}},
+		{"partial refill", 2, 1, []take{{0, true}, {250 * time.Millisecond, false}, {500 * time.Millisecond, true}}},
+		{"capped at burst", 10, 2, []take{{time.Hour, true}, {time.Hour, true}, {time.Hour, false}}},
+		{"burst of at least one", 1, 0, []take{{0, true}, {0, false}}},
+	}
+	for _, tt := range tests {
+		b := newBucket(tt.rate, tt.burst)
+		if b != nil {
+			b.last = start
+		}
+		for i, tk := range tt.takes {
+			if got := b.allow(start.Add(tk.at)); got != tk.want {
+				t.Errorf("%s: take %d at %v = %v; want %v", tt.name, i, tk.at, got, tk.want)
+			}
+		}
+	}
+}
+
+func TestLimiterConnect(t *testing.T) {
+	tests := []struct {
+		name  string
+		l     *Limiter
+		ips   []string
+		wants []error
+	}{
+		{"nil", nil, []string{"1.1.1.1", "1.1.1.1"}, []error{nil, nil}},
+		{"unlimited", NewLimiter(Limits{}), []string{"1.1.1.1", "1.1.1.1"}, []error{nil, nil}},
+		{"burst per address", NewLimiter(Limits{ConnectRate: 0.001, ConnectBurst: 2}),
+			[]string{"1.1.1.1", "1.1.1.1", "2.2.2.2", "1.1.1.1", "2.2.2.2", "2.2.2.2"},
+			[]error{nil, nil, nil, ErrTooManyConnections, nil, ErrTooManyConnections}},
+	}
+	for _, tt := range tests {
+		for i, ip := range tt.ips {
+			if err := tt.l.Connect(ip); err != tt.wants[i] {
+				t.Errorf("%s: connection %d from %s = %v; want %v", tt.name, i, ip, err, tt.wants[i])
+			}
+		}
+	}
+}
+
+func TestConnLimit(t *testing.T) {
+	l := NewLimiter(Limits{MessageRate: 0.001, MessageBurst: 2, IPMessageRate: 0.001, IPMessageBurst: 3})
+	first, second := l.Conn(nil, "1.1.1.1"), l.Conn(nil, "1.1.1.1")
+	other := l.Conn(nil, "2.2.2.2")
+
+	tests := []struct {
+		name string
+		c    *ConnLimit
+		want bool
+	}{
+		{"first message", first, true},
+		{"second message", first, true},
+		{"connection burst spent", first, false},
+		{"address burst shared", second, true},
+		{"address burst spent", second, false},
+		{"other address", other, true},
+		{"nil", nil, true},
+	}
+	for _, tt := range tests {
+		if got := tt.c.allow(); got != tt.want {
+			t.Errorf("%s: allow() = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// The address's buckets are released once every connection is done, and only once per connection.
+	first.done()
+	first.done()
+	if conns := l.get("1.1.1.1").conns; conns != 1 {
+		t.Errorf("after one connection is done: %d connections; want 1", conns)
+	}
+	second.done()
+	if conns := l.get("1.1.1.1").conns; conns != 0 {
+		t.Errorf("after every connection is done: %d connections; want 0", conns)
+	}
+}
@@ -0,0 +1,311 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/natsukagami/hakkero-project/backend/protocol"
+)
+
+// lobbyTimeout is the time an empty lobby is kept before being removed.
+const lobbyTimeout = 10 * time.Minute
+
+// maxLobbies is the number of lobbies that can be open at once.
+const maxLobbies = 10000
+
+// ErrTooManyLobbies is returned when no more lobbies can be opened.
+var ErrTooManyLobbies = errors.New("too many lobbies are open, please try again later")
+
+// Lobby is a private waiting room, joined by an invite code.
+// The host starts the game whenever they are ready.
+type Lobby struct {
+	Code     string
+	Settings RoomSettings
+	mu       sync.Mutex
+	key      string // The host's secret key.
+	Host     *QueueConn
+	Players  []*QueueConn
+	started  bool
+}
+
+// announce sends the member list to all members.
+// It must be called with the lock held.
+func (l *Lobby) announce() {
+	members := make([]string, len(l.Players))
+	for id, p := range l.Players {
+		members[id] = p.Username
+	}
+	var wg sync.WaitGroup
+	for _, p := range l.Players {
+		wg.Add(1)
+		go func(p *QueueConn) {
+			defer wg.Done()
+			p.SendMessage(Message{
+				Type: protocol.TypeLobby,
+				Message: protocol.Lobby{
+					Code:    l.Code,
+					Members: members,
+					Host:    p == l.Host,
+				},
+			})
+		}(p)
+	}
+	wg.Wait()
+}
+
+// join adds the player into the lobby, if it is not full.
+func (l *Lobby) join(player *QueueConn, key string, limit int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.started {
+		return errors.New("the lobby has already started")
+	}
+	if len(l.Players) >= limit {
+		return errors.New("the lobby is full")
+	}
+	if key == l.key && l.Host == nil {
+		l.Host = player
+	}
+	l.Players = append(l.Players, player)
+	l.announce()
+	return nil
+}
+
+// leave removes the player from the lobby.
+// Returns true if the lobby should be closed.
+func (l *Lobby) leave(player *QueueConn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id, p := range l.Players {
+		if p == player {
+			l.Players = append(l.Players[:id], l.Players[id+1:]...)
+			break
+		}
+	}
+	if l.started {
+		return false
+	}
+	if len(l.Players) == 0 {
+		l.started = true
+		return true
+	}
+	if player == l.Host {
+		// The lobby cannot start without its host.
+		l.started = true
+		Broadcast(l.Players, Message{
+			Type: protocol.TypeAnnouncement,
+			Message: protocol.Announcement{
+				Success:      false,
+				Announcement: "The host has left the lobby.",
+			},
+		})
+		for _, p := range l.Players {
+			p.Close()
+		}
+		return true
+	}
+	l.announce()
+	return false
+}
+
+// Lobbies manages the private lobbies.
+type Lobbies struct {
+	Config   Config
+	Rooms    RoomManager
+	OP       OpenSentencer
+	Accounts *Accounts // The account system. If nil, usernames are not reserved.
+	// The content filter of usernames. If nil, usernames are not filtered.
+	Moderation *Moderation
+	Bans       *Bans    // The banned users. If nil, nobody is banned.
+	Limiter    *Limiter // The flood protection of lobby connections. If nil, there is none.
+	mu         sync.Mutex
+	lobbies    map[string]*Lobby
+}
+
+// New creates a new lobby with the given settings, returning it along with the host's key.
+// It returns ErrTooManyLobbies if maxLobbies are already open.
+func (ls *Lobbies) New(settings RoomSettings) (*Lobby, string, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if len(ls.lobbies) >= maxLobbies {
+		return nil, "", ErrTooManyLobbies
+	}
+	code := randStringBytesMaskImpr(6)
+	for ls.lobbies[code] != nil {
+		code = randStringBytesMaskImpr(6)
+	}
+	l := &Lobby{Code: code, Settings: settings, key: randToken()}
+	ls.lobbies[code] = l
+	time.AfterFunc(lobbyTimeout, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if len(l.Players) == 0 {
+			ls.remove(code)
+		}
+	})
+	return l, l.key, nil
+}
+
+// Get returns the lobby with the given invite code.
+func (ls *Lobbies) Get(code string) (*Lobby, bool) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	l, ok := ls.lobbies[code]
+	return l, ok
+}
+
+func (ls *Lobbies) remove(code string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	delete(ls.lobbies, code)
+}
+
+// Start starts the lobby's game, if there are enough players.
+func (ls *Lobbies) Start(l *Lobby) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.started {
+		return
+	}
+	fail := func(announcement string) {
+		Broadcast(l.Players, Message{
+			Type: protocol.TypeAnnouncement,
+			Message: protocol.Announcement{
+				Success:      false,
+				Announcement: announcement,
+			},
+		})
+	}
+	if len(l.Players) < 2 {
+		fail("At least 2 players are needed to start a game.")
+		return
+	}
+	os, err := ls.OP.OpenSentence(l.Settings.Category)
+	if err != nil {
+		fail("Cannot find a proper open sentence. Please try again!")
+		return
+	}
+	id, err := ls.Rooms.NewPrivate(userFromConn(l.Players), l.Settings, os)
+	if err != nil {
+		fail("Cannot set up a game room. Please try again!")
+		return
+	}
+	l.started = true
+	announceRoom(ls.Rooms, l.Players, id)
+	for _, p := range l.Players {
+		p.Close()
+	}
+	ls.remove(l.Code)
+}
+
+// listen handles the player's requests until they leave.
+func (ls *Lobbies) listen(l *Lobby, player *QueueConn) {
+	for m := range player.Send {
+		if m.Start && player == l.Host {
+			ls.Start(l)
+		}
+	}
+	if l.leave(player) {
+		ls.remove(l.Code)
+	}
+}
+
+// ServeHTTP serves the lobbies.
+// A POST on /lobbies creates a new lobby, taking optional RoomSettings as the JSON body,
+// while /lobbies/{code} is the lobby's websocket. Creating a lobby counts against the connect limit.
+func (ls *Lobbies) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/lobbies" {
+		if r.Method != "POST" {
+			w.WriteHeader(405)
+			return
+		}
+		if err := ls.Limiter.Connect(clientIP(r)); err != nil {
+			writeError(w, 429, err)
+			return
+		}
+		settings := ls.Config.Settings
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+				w.WriteHeader(400)
+				w.Write([]byte("{\"error\": \"Invalid settings\"}"))
+				return
+			}
+		}
+		if err := settings.Validate(); err != nil {
+			data, _ := json.Marshal(map[string]string{"error": err.Error()})
+			w.WriteHeader(400)
+			w.Write(data)
+			return
+		}
+		l, key, err := ls.New(settings)
+		if err != nil {
+			writeError(w, 503, err)
+			return
+		}
+		data, _ := json.Marshal(map[string]string{"code": l.Code, "host": key})
+		w.Write(data)
+		return
+	}
+	l, ok := ls.Get(r.URL.Path[len("/lobbies/"):])
+	if !ok {
+		w.WriteHeader(404)
+		w.Write([]byte("{\"error\": \"No such lobby\"}"))
+		return
+	}
+	r.ParseForm()
+	user, err := ls.Accounts.Identify(r.FormValue("username"), r.FormValue("session"))
+	if err == nil {
+		user.Username, err = ls.Moderation.Username(user.Username)
+	}
+	if err != nil {
+		writeError(w, 400, err)
+		return
+	}
+	if err := ls.Bans.Check(user, clientIP(r)); err != nil {
+		writeError(w, 403, err)
+		return
+	}
+	if err := ls.Limiter.Connect(clientIP(r)); err != nil {
+		writeError(w, 429, err)
+		return
+	}
+	version, err := protocol.Negotiate(r.FormValue("v"))
+	if err != nil {
+		writeError(w, 400, err)
+		return
+	}
+	openTransport(w, r, func(t Transport) {
+		pConn := Enqueue(t, user, ls.Limiter.Conn(t, clientIP(r)), ls.Config.Heartbeat)
+		pConn.SendMessage(helloMessage(version))
+		if err := l.join(pConn, r.FormValue("host"), ls.Config.PlayerLimit); err != nil {
+			pConn.SendMessage(Message{
+				Type: protocol.TypeAnnouncement,
+				Message: protocol.Announcement{
+					Success:      false,
+					Announcement: fmt.Sprintf("Cannot join: %v.", err),
+				},
+			})
+			pConn.Close()
+			return
+		}
+		go ls.listen(l, pConn)
+	})
+}
+
+// NewLobbies returns a new lobby manager.
+func NewLobbies(r RoomManager, c Config, op OpenSentencer, accounts *Accounts, mod *Moderation, bans *Bans, lim *Limiter) *Lobbies {
+	return &Lobbies{
+		Config:     c,
+		Rooms:      r,
+		OP:         op,
+		Accounts:   accounts,
+		Moderation: mod,
+		Bans:       bans,
+		Limiter:    lim,
+		lobbies:    make(map[string]*Lobby),
+	}
+}
@@ -2,5 +2,7 @@ package backend
 
 // OpenSentencer represents an interface where a fetch on an opeing sentence is made.
 type OpenSentencer interface {
-	OpenSentence() (string, error)
+	// OpenSentence returns an opening sentence of the given category.
+	// An empty category means any category.
+	OpenSentence(category string) (string, error)
 }
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"errors"
 	"math/rand"
 	"time"
 )
@@ -11,7 +12,11 @@ type staticOpenSentence struct {
 	rnd rand.Source
 }
 
-func (s *staticOpenSentence) OpenSentence() (string, error) {
+func (s *staticOpenSentence) OpenSentence(category string) (string, error) {
+	// There is only one category of static open sentences.
+	if category != "" && category != "classic" {
+		return "", errors.New("unknown category")
+	}
 	n := s.rnd.Int63() % int64(len(staticOPs))
 	return staticOPs[n], nil
 }
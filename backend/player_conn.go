@@ -2,99 +2,166 @@ package backend
 
 import (
 	"log"
+	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/natsukagami/hakkero-project/backend/protocol"
 	"github.com/pkg/errors"
 )
 
+// sendBuffer is the number of incoming messages kept while the handler is busy.
+// Messages beyond it are dropped, so that reading, and the heartbeat, go on.
+const sendBuffer = 16
+
 // Conn represents a client connection.
 type Conn struct {
-	*websocket.Conn
+	Transport
 	Recv chan Message // The channel for receiving messages.
 
 	Error error // The error variable, if it is set then the connection no longer is valuable.
-	// the dedicated error channel
+	// the dedicated error channel, closed when Error is set.
 	ErrChan chan error
+	errOnce sync.Once
+	limit   *ConnLimit    // The limit of incoming messages.
+	timeout time.Duration // The read timeout, extended by every message and pong.
 }
 
 // PlayerConn represents a Player Connection.
 type PlayerConn struct {
 	Conn
 	Send chan MessageRequest // The channel for sending messages.
+
+	outMu    sync.Mutex
+	outbox   []Message     // The broadcast messages waiting to be delivered, in order.
+	outReady chan struct{} // Signalled when the outbox is no longer empty.
 }
 
-// Just broadcast error forever.
+// Broadcast the error by closing the error channel, so that every listener is woken up.
 func (p *Conn) broadcastError(err error) {
-	if p.Error != nil {
-		return // Only do the first error
-	}
-	p.Error = err
-	for {
-		p.ErrChan <- p.Error
+	// Only do the first error
+	p.errOnce.Do(func() {
+		p.Error = err
+		close(p.ErrChan)
+		p.limit.done()
+	})
+}
+
+// closeWith closes the connection with the given close code and reason.
+func (p *Conn) closeWith(code int, reason string) {
+	p.CloseWith(code, reason)
+	p.broadcastError(errors.New(reason))
+}
+
+// allow checks an incoming message against the limit, closing the connection if it is flooding.
+func (p *Conn) allow() bool {
+	if p.limit.allow() {
+		return true
 	}
+	p.closeWith(protocol.CloseRateLimited, "rate limit exceeded")
+	return false
 }
 
-// receiver fetches messages from Handler and passes it to user.
+// receiver fetches messages from Handler and passes it to user, until the connection fails.
 func (p *Conn) receiver() {
-msg:
-	for ms := range p.Recv {
+	for {
 		select {
-		case <-p.ErrChan:
-
+		case ms := <-p.Recv:
+			err := p.WriteJSON(&ms)
+			log.Println(ms)
 			ms.done <- struct{}{}
-			continue msg // If an error occurs, just consume.
-		default:
-		}
-		err := p.Conn.WriteJSON(&ms)
-		log.Println(ms)
-		ms.done <- struct{}{}
-		if err != nil {
-			go p.broadcastError(errors.Wrap(err, "playerconn write"))
+			if err != nil {
+				go p.broadcastError(errors.Wrap(err, "playerconn write"))
+			}
+		case <-p.ErrChan:
+			return
 		}
 	}
 }
 
 // SendMessage sends a message to the client, waiting for done.
+// It returns at once if the connection has failed.
 func (p *Conn) SendMessage(m Message) {
 	m.done = make(chan struct{})
-	p.Recv <- m
-	<-m.done
+	select {
+	case p.Recv <- m:
+		<-m.done
+	case <-p.ErrChan:
+	}
+}
+
+// push queues a broadcast message without waiting. Queued messages are delivered in order.
+func (p *PlayerConn) push(m Message) {
+	p.outMu.Lock()
+	p.outbox = append(p.outbox, m)
+	p.outMu.Unlock()
+	select {
+	case p.outReady <- struct{}{}:
+	default: // Already signalled.
+	}
+}
+
+// deliver sends the queued messages to the client, until the connection fails.
+func (p *PlayerConn) deliver() {
+	for {
+		select {
+		case <-p.outReady:
+			p.outMu.Lock()
+			queued := p.outbox
+			p.outbox = nil
+			p.outMu.Unlock()
+			for _, m := range queued {
+				p.SendMessage(m)
+			}
+		case <-p.ErrChan:
+			return
+		}
+	}
 }
 
 // forwarder fetches messages from user interface and forwards it to Handler.
 func (p *PlayerConn) forwarder() {
-	p.Conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
 	defer close(p.Send)
 	for p.Error == nil {
 		var ms MessageRequest
-		err := p.Conn.ReadJSON(&ms)
+		err := p.ReadJSON(&ms)
 		log.Println(ms)
 		if err != nil {
 			go p.broadcastError(errors.Wrap(err, "playerconn read"))
 			return
 		}
+		if !p.allow() {
+			return
+		}
+		p.extend()
 		ms.Received = time.Now()
-		go func() { p.Send <- ms }()
+		select {
+		case p.Send <- ms:
+		default:
+			log.Printf("%v: dropped a message, the room is busy\n", p.RemoteAddr())
+		}
 	}
 }
 
 // Close closes the player connection.
 func (p *Conn) Close() error {
-	close(p.Recv)
-	return p.Conn.Close()
+	p.broadcastError(errors.New("connection closed"))
+	return p.Transport.Close()
 }
 
-// Prepare fires up the PlayerConn for usage
-func Prepare(conn *websocket.Conn) *PlayerConn {
+// Prepare fires up the PlayerConn for usage, with the given limit (nil for none) and heartbeat.
+func Prepare(t Transport, limit *ConnLimit, hb Heartbeat) *PlayerConn {
 	p := &PlayerConn{
 		Conn: Conn{
-			Conn:    conn,
-			ErrChan: make(chan error)},
+			Transport: t,
+			ErrChan:   make(chan error),
+			limit:     limit},
 	}
 	p.Recv = make(chan Message)
-	p.Send = make(chan MessageRequest)
+	p.Send = make(chan MessageRequest, sendBuffer)
+	p.outReady = make(chan struct{}, 1)
+	p.keepAlive(hb)
 	go p.forwarder()
 	go p.receiver()
+	go p.deliver()
 	return p
 }
@@ -0,0 +1,152 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Profile is a player's statistics, computed from their stored games.
+type Profile struct {
+	Username      string  `json:"username"`
+	Registered    bool    `json:"registered"`
+	Rating        *Rating `json:"rating,omitempty"` // Only registered players are rated.
+	Games         int     `json:"games"`
+	Wins          int     `json:"wins"`
+	Sentences     int     `json:"sentences"`
+	AverageLength float64 `json:"averageLength"` // The average sentence length, in characters.
+	Skips         int     `json:"skips"`
+	Timeouts      int     `json:"timeouts"`
+}
+
+// GameSummary is an entry of a player's game history.
+type GameSummary struct {
+	ID      int       `json:"id"`
+	Start   time.Time `json:"start"`
+	Members []User    `json:"members"`
+	Ended   bool      `json:"ended"`
+	Won     bool      `json:"won"`
+	Story   string    `json:"story"`  // The link to the exported story.
+	Replay  string    `json:"replay"` // The link to the replay websocket.
+}
+
+// Profiles computes the players' profiles from the stored games.
+type Profiles struct {
+	Store    RoomStore
+	Ratings  *Ratings  // If nil, profiles do not show ratings.
+	Accounts *Accounts // If set, only games played while logged in count for registered usernames.
+}
+
+// each calls f on every game the player has played, with their index in the room.
+func (ps *Profiles) each(username string, f func(r Room, index int)) (registered bool, err error) {
+	registered = ps.Accounts != nil && ps.Accounts.Reserved(username)
+	err = ps.Store.Each(func(r Room) error {
+		for id, member := range r.Members {
+			if member.Username == username && (!registered || member.Registered) {
+				f(r, id)
+				break
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// Profile returns the player's profile.
+func (ps *Profiles) Profile(username string) (Profile, error) {
+	p := Profile{Username: username}
+	length := 0
+	registered, err := ps.each(username, func(r Room, index int) {
+		p.Games++
+		if r.Ended() && r.Winner() == index {
+			p.Wins++
+		}
+		for _, sent := range r.Sentences {
+			if !sent.System && sent.Owner == index {
+				p.Sentences++
+				length += utf8.RuneCountInString(sent.Content)
+			}
+		}
+		if index < len(r.Skips) {
+			p.Skips += r.Skips[index]
+		}
+		switch r.Status[index] {
+		case StatusOut:
+			p.Skips++
+		case StatusDc:
+			p.Timeouts++
+		}
+	})
+	if err != nil {
+		return p, err
+	}
+	p.Registered = registered
+	if p.Sentences > 0 {
+		p.AverageLength = float64(length) / float64(p.Sentences)
+	}
+	if ps.Ratings != nil && registered {
+		rating := ps.Ratings.Get(username)
+		p.Rating = &rating
+	}
+	return p, nil
+}
+
+// Games returns the player's public games, newest first.
+func (ps *Profiles) Games(username string) ([]GameSummary, error) {
+	games := make([]GameSummary, 0)
+	_, err := ps.each(username, func(r Room, index int) {
+		if r.Private {
+			return
+		}
+		games = append(games, GameSummary{
+			ID:      r.ID,
+			Start:   r.Start,
+			Members: r.Members,
+			Ended:   r.Ended(),
+			Won:     r.Ended() && r.Winner() == index,
+			Story:   fmt.Sprintf("/rooms/%d/export?format=html", r.ID),
+			Replay:  fmt.Sprintf("/rooms/%d/replay", r.ID),
+		})
+	})
+	sort.Slice(games, func(i, j int) bool { return games[i].ID > games[j].ID })
+	return games, err
+}
+
+// ServeHTTP serves /users/{name} and /users/{name}/games.
+func (ps *Profiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(405)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/users/")
+	name, action := path, ""
+	if slash := strings.IndexByte(path, '/'); slash >= 0 {
+		name, action = path[:slash], path[slash+1:]
+	}
+	if !validUsername(name) {
+		writeError(w, 400, errors.New("invalid username"))
+		return
+	}
+	switch action {
+	case "":
+		p, err := ps.Profile(name)
+		if err != nil {
+			writeError(w, 500, err)
+			return
+		}
+		writeJSON(w, 200, p)
+	case "games":
+		games, err := ps.Games(name)
+		if err != nil {
+			writeError(w, 500, err)
+			return
+		}
+		writeJSON(w, 200, games)
+	default:
+		w.WriteHeader(404)
+	}
+}
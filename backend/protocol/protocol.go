@@ -0,0 +1,126 @@
+// Package protocol describes the messages exchanged between the Hakkero Project's
+// server and its clients, over the room, queue and lobby connections.
+//
+// Every message from the server is a Message envelope, whose Type tells which
+// payload it carries (see Messages). Clients answer with a Request in rooms, and
+// with a QueueResponse in the queue and lobbies.
+//
+// Clients ask for a protocol version with the "v" query parameter when connecting.
+// The server answers with a "hello" message carrying the version it speaks, before
+// anything else. The JSON Schema and TypeScript definitions of the protocol are
+// generated from this package by the hakkero-protocol-gen command.
+package protocol
+
+//go:generate go run ../cmd/hakkero-protocol-gen -schema protocol.schema.json -ts ../../frontend/src/protocol.d.ts
+
+import (
+	"errors"
+	"strconv"
+)
+
+// The protocol versions the server speaks.
+const (
+	Version    = 1 // The latest version.
+	MinVersion = 1 // The oldest version still supported.
+)
+
+// Websocket close codes sent to clients refused a connection, or cut off.
+const (
+	CloseInvalidToken       = 4001 // The player's token is invalid.
+	CloseExpiredToken       = 4002 // The player's token has expired.
+	CloseUnsupportedVersion = 4003 // The version asked for is no longer supported.
+	CloseNoSpectators       = 4004 // The game does not allow spectators, and the client is not playing it.
+	CloseRateLimited        = 4005 // The client sent messages too fast.
+)
+
+// closeCodes names the close codes in the generated definitions.
+var closeCodes = []struct {
+	Name string
+	Code int
+}{
+	{"CLOSE_INVALID_TOKEN", CloseInvalidToken},
+	{"CLOSE_EXPIRED_TOKEN", CloseExpiredToken},
+	{"CLOSE_UNSUPPORTED_VERSION", CloseUnsupportedVersion},
+	{"CLOSE_NO_SPECTATORS", CloseNoSpectators},
+	{"CLOSE_RATE_LIMITED", CloseRateLimited},
+}
+
+// ErrUnsupportedVersion is returned when negotiating a version that is no longer supported.
+var ErrUnsupportedVersion = errors.New("unsupported protocol version, the server speaks versions " +
+	strconv.Itoa(MinVersion) + " to " + strconv.Itoa(Version))
+
+// Negotiate returns the version to speak with a client asking for the requested one.
+// Clients not asking get the latest version, and clients newer than the server get
+// the latest version too, so that they can fall back on it.
+func Negotiate(requested string) (int, error) {
+	if requested == "" {
+		return Version, nil
+	}
+	v, err := strconv.Atoi(requested)
+	if err != nil || v < MinVersion {
+		return 0, ErrUnsupportedVersion
+	}
+	if v > Version {
+		return Version, nil
+	}
+	return v, nil
+}
+
+// Payload is the content of a message from the server.
+type Payload interface {
+	IsMessage()
+}
+
+// Message is the envelope of every message from the server.
+type Message struct {
+	Type    string  `json:"type"`
+	Message Payload `json:"message"`
+	Seq     *int    `json:"seq,omitempty"` // The position in the room's event log, set on room broadcasts.
+}
+
+// The types of the messages from the server.
+const (
+	TypeHello        = "hello"
+	TypeIndex        = "index"
+	TypeTurn         = "turn"
+	TypeSentence     = "sentence"
+	TypeEnd          = "end"
+	TypeVote         = "vote"
+	TypeRejected     = "rejected"
+	TypeRedact       = "redact"
+	TypeVoteKick     = "votekick"
+	TypeJoin         = "join"
+	TypeDisconnect   = "disconnect"
+	TypeReported     = "reported"
+	TypeFound        = "found"
+	TypeAnnouncement = "announcement"
+	TypeSize         = "size"
+	TypeLobby        = "lobby"
+)
+
+// Messages maps the type of every message from the server to its payload.
+var Messages = map[string]Payload{
+	TypeHello:        Hello{},
+	TypeIndex:        Index{},
+	TypeTurn:         Turn{},
+	TypeSentence:     NewSentence{},
+	TypeEnd:          End{},
+	TypeVote:         Vote{},
+	TypeRejected:     Rejected{},
+	TypeRedact:       Redact{},
+	TypeVoteKick:     VoteKick{},
+	TypeJoin:         Join{},
+	TypeDisconnect:   Disconnect{},
+	TypeReported:     Reported{},
+	TypeFound:        Found{},
+	TypeAnnouncement: Announcement{},
+	TypeSize:         QueueSize{},
+	TypeLobby:        Lobby{},
+}
+
+// Hello opens every connection, telling the client the version the server speaks.
+type Hello struct {
+	Version int `json:"version"`
+}
+
+func (Hello) IsMessage() {}
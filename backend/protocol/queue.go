@@ -0,0 +1,38 @@
+package protocol
+
+// QueueResponse is a message from a player waiting in the queue or a lobby.
+type QueueResponse struct {
+	Accepted bool `json:"accepted,omitempty"` // Whether the player accepts the match found.
+	Start    bool `json:"start,omitempty"`    // Used by private lobby hosts to start the game.
+}
+
+// Found represents a "Match Found" message, to be answered with a QueueResponse.
+type Found struct{}
+
+func (Found) IsMessage() {}
+
+// Announcement represents a "Matchmaking Success/Failed" message.
+type Announcement struct {
+	Success      bool   `json:"success"`
+	Room         int    `json:"room"`
+	Token        string `json:"token,omitempty"` // The player's token to join the room, on success.
+	Announcement string `json:"announcement,omitempty"`
+}
+
+func (Announcement) IsMessage() {}
+
+// QueueSize tells the number of players waiting in the queue.
+type QueueSize struct {
+	Size int `json:"size"`
+}
+
+func (QueueSize) IsMessage() {}
+
+// Lobby tells the members of a private lobby.
+type Lobby struct {
+	Code    string   `json:"code"`
+	Members []string `json:"members"`
+	Host    bool     `json:"host"` // Whether the receiver is the host.
+}
+
+func (Lobby) IsMessage() {}
@@ -0,0 +1,163 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Status represents a player's status in a room.
+type Status int
+
+// Status constants.
+const (
+	StatusActive Status = iota
+	StatusOut
+	StatusDc
+	StatusTurn
+)
+
+// statusNames are the names statuses are sent as.
+var statusNames = []string{
+	StatusActive: "active",
+	StatusOut:    "skipped",
+	StatusDc:     "disconnected",
+	StatusTurn:   "turn",
+}
+
+// MarshalJSON returns the status of the player in JSON.
+// Numbers are not the pretty thing, we send status strings instead.
+func (s Status) MarshalJSON() ([]byte, error) {
+	if s < 0 || int(s) >= len(statusNames) {
+		return json.Marshal("unknown")
+	}
+	return json.Marshal(statusNames[s])
+}
+
+// Sentence is a sentence written is a room-wide paragraph.
+// The sentence could be an user's sentence, or a system announcement
+// (e.g. An user has left the game).
+type Sentence struct {
+	Content  string `json:"content"`
+	Owner    int    `json:"owner"`              // The user index (in the User slice) who wrote this sentence. In the case of a system announcement, this is left empty.
+	System   bool   `json:"system,omitempty"`   // Indicate that it's a system announcement.
+	Votes    int    `json:"votes,omitempty"`    // The votes the sentence received at the end of the game.
+	Flagged  bool   `json:"flagged,omitempty"`  // Whether the content filter flagged the sentence for review.
+	Redacted bool   `json:"redacted,omitempty"` // Whether an operator removed the sentence. The content is replaced, too.
+}
+
+// Progress reports how far the game is from its limits.
+// Unset fields mean there is no such limit.
+type Progress struct {
+	RoundsLeft *int       `json:"roundsLeft,omitempty"`
+	WordsLeft  *int       `json:"wordsLeft,omitempty"`
+	Deadline   *time.Time `json:"deadline,omitempty"`
+}
+
+// Ballot is a vote for a favourite sentence or author. Exactly one of them is set.
+type Ballot struct {
+	Sentence *int `json:"sentence,omitempty"` // The position of the sentence.
+	Author   *int `json:"author,omitempty"`   // The index of the member.
+}
+
+// Report is a complaint about either a sentence or a member.
+type Report struct {
+	Sentence *int   `json:"sentence,omitempty"` // The position of the sentence.
+	Member   *int   `json:"member,omitempty"`   // The index of the member.
+	Reason   string `json:"reason"`
+}
+
+// Request is a message from a player or a spectator to the room.
+// Spectators can only report, or vote if the room lets them.
+type Request struct {
+	Skip     bool    `json:"skip,omitempty"`     // Set when skipping the turn.
+	Content  string  `json:"content,omitempty"`  // The sentence written on the player's turn.
+	Vote     *Ballot `json:"vote,omitempty"`     // Set when voting at the end of the game.
+	Report   *Report `json:"report,omitempty"`   // Set when reporting a sentence or a member.
+	VoteKick *int    `json:"votekick,omitempty"` // Set when voting to kick the member with this index.
+}
+
+// Index announces their own position on the board to players.
+type Index struct {
+	Index int `json:"index"`
+}
+
+func (Index) IsMessage() {}
+
+// Turn contains the current turn's status, and the next turn's index and clock time.
+type Turn struct {
+	Status   []Status  `json:"status"`
+	Time     time.Time `json:"current"`
+	Progress Progress  `json:"progress"` // The progress toward the end of the game.
+}
+
+func (Turn) IsMessage() {}
+
+// NewSentence contains the information of an occurring next sentence.
+type NewSentence struct {
+	Sentence Sentence `json:"sentence"`
+	Pos      int      `json:"pos"` // The position in the paragraph.
+}
+
+func (NewSentence) IsMessage() {}
+
+// End passes the End indicator.
+type End struct {
+	Winner        int   `json:"winner"`                  // Index of the winner.
+	Votes         []int `json:"votes,omitempty"`         // The votes each member received, if the room voted.
+	SentenceVotes []int `json:"sentenceVotes,omitempty"` // The votes each sentence received, if the room voted.
+	VoteWinner    int   `json:"voteWinner"`              // Index of the member with the most votes, or -1.
+}
+
+func (End) IsMessage() {}
+
+// Vote opens the voting phase.
+type Vote struct {
+	Sentences []int     `json:"sentences"` // The positions of the sentences that can be voted for.
+	Deadline  time.Time `json:"deadline"`
+}
+
+func (Vote) IsMessage() {}
+
+// Rejected tells the sender why their request was rejected.
+type Rejected struct {
+	Reason string `json:"reason"`
+}
+
+func (Rejected) IsMessage() {}
+
+// Redact announces that a sentence has been removed.
+type Redact struct {
+	Pos int `json:"pos"`
+}
+
+func (Redact) IsMessage() {}
+
+// VoteKick announces the progress of a vote to kick a member.
+type VoteKick struct {
+	Target int `json:"target"`
+	Votes  int `json:"votes"`
+	Needed int `json:"needed"`
+}
+
+func (VoteKick) IsMessage() {}
+
+// Join announces a player's (re)connection.
+type Join struct {
+	Index int `json:"index"`
+}
+
+func (Join) IsMessage() {}
+
+// Disconnect announces a player's disconnection.
+type Disconnect struct {
+	Index int `json:"index"`
+}
+
+func (Disconnect) IsMessage() {}
+
+// Reported acknowledges a report.
+type Reported struct {
+	ID int `json:"id"`
+}
+
+func (Reported) IsMessage() {}
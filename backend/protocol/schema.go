@@ -0,0 +1,262 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	statusType  = reflect.TypeOf(Status(0))
+	timeType    = reflect.TypeOf(time.Time{})
+	messageType = reflect.TypeOf(json.RawMessage(nil)) // A message from the server, passed on as is.
+)
+
+// field is a struct field as it appears in JSON.
+type field struct {
+	Name     string
+	Type     reflect.Type
+	Optional bool
+}
+
+// fields returns the JSON fields of the struct type.
+func fields(t reflect.Type) []field {
+	var list []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.PkgPath != "" || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		list = append(list, field{
+			Name:     name,
+			Type:     f.Type,
+			Optional: strings.Contains(opts, "omitempty") || f.Type.Kind() == reflect.Ptr,
+		})
+	}
+	return list
+}
+
+// messageTypes returns the types of the messages from the server, sorted.
+func messageTypes() []string {
+	types := make([]string, 0, len(Messages))
+	for typ := range Messages {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// definitions collects the named types reachable from the messages, in the order they are met.
+type definitions struct {
+	seen  map[reflect.Type]bool
+	order []reflect.Type
+}
+
+func (d *definitions) add(t reflect.Type) {
+	switch {
+	case t == messageType:
+		return
+	case t.Kind() == reflect.Ptr, t.Kind() == reflect.Slice:
+		d.add(t.Elem())
+		return
+	}
+	if t == timeType || d.seen[t] || (t.Kind() != reflect.Struct && t != statusType) {
+		return
+	}
+	d.seen[t] = true
+	d.order = append(d.order, t)
+	if t.Kind() == reflect.Struct {
+		for _, f := range fields(t) {
+			d.add(f.Type)
+		}
+	}
+}
+
+// collect returns the named types of the protocol: every payload, then the clients' messages,
+// then the framing of the HTTP transports.
+func collect() []reflect.Type {
+	d := &definitions{seen: make(map[reflect.Type]bool)}
+	for _, typ := range messageTypes() {
+		d.add(reflect.TypeOf(Messages[typ]))
+	}
+	d.add(reflect.TypeOf(Request{}))
+	d.add(reflect.TypeOf(QueueResponse{}))
+	d.add(reflect.TypeOf(Session{}))
+	d.add(reflect.TypeOf(PollResponse{}))
+	return d.order
+}
+
+// jsonSchema returns the JSON Schema of the type, referring to named types by name.
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == statusType:
+		return map[string]interface{}{"$ref": "#/$defs/Status"}
+	case t == messageType:
+		return map[string]interface{}{"$ref": "#"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return jsonSchema(t.Elem())
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	}
+	panic("protocol: no schema for " + t.String())
+}
+
+// definition returns the JSON Schema defining the named type.
+func definition(t reflect.Type) map[string]interface{} {
+	if t == statusType {
+		return map[string]interface{}{"type": "string", "enum": statusNames}
+	}
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+	for _, f := range fields(t) {
+		properties[f.Name] = jsonSchema(f.Type)
+		if !f.Optional {
+			required = append(required, f.Name)
+		}
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// Schema returns the JSON Schema of the messages from the server.
+// The clients' messages are defined as Request and QueueResponse, the
+// framing of the HTTP transports as Session, SessionClosed and PollResponse,
+// and the server's own close codes as CloseCode.
+func Schema() ([]byte, error) {
+	defs := make(map[string]interface{})
+	for _, t := range collect() {
+		defs[t.Name()] = definition(t)
+	}
+	codes := make([]int, len(closeCodes))
+	for i, c := range closeCodes {
+		codes[i] = c.Code
+	}
+	defs["CloseCode"] = map[string]interface{}{
+		"description": "The websocket close codes of the server, besides the standard ones.",
+		"type":        "integer",
+		"enum":        codes,
+	}
+	var messages []interface{}
+	for _, typ := range messageTypes() {
+		messages = append(messages, map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"type":    map[string]interface{}{"const": typ},
+				"message": jsonSchema(reflect.TypeOf(Messages[typ])),
+				"seq":     map[string]interface{}{"type": "integer"},
+			},
+			"required":             []string{"type", "message"},
+			"additionalProperties": false,
+		})
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     fmt.Sprintf("https://github.com/natsukagami/hakkero-project/protocol/v%d", Version),
+		"title":   fmt.Sprintf("Hakkero Project protocol, version %d", Version),
+		"oneOf":   messages,
+		"$defs":   defs,
+	}, "", "  ")
+}
+
+// typeScript returns the TypeScript type of the type.
+func typeScript(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "string"
+	case t == statusType:
+		return "Status"
+	case t == messageType:
+		return "Message"
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeScript(t.Elem())
+	case reflect.Slice:
+		return typeScript(t.Elem()) + "[]"
+	case reflect.Struct:
+		return t.Name()
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int64:
+		return "number"
+	}
+	panic("protocol: no TypeScript type for " + t.String())
+}
+
+// JavaScript returns the JavaScript module of the protocol's constants,
+// which the TypeScript definitions describe.
+func JavaScript() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by hakkero-protocol-gen. DO NOT EDIT.\n\nexport const VERSION = %d;\n", Version)
+	for _, c := range closeCodes {
+		fmt.Fprintf(&b, "export const %s = %d;\n", c.Name, c.Code)
+	}
+	return b.Bytes()
+}
+
+// TypeScript returns the TypeScript definitions of the protocol.
+func TypeScript() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by hakkero-protocol-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "export declare const VERSION: %d;\n", Version)
+	for _, c := range closeCodes {
+		fmt.Fprintf(&b, "export declare const %s: %d;\n", c.Name, c.Code)
+	}
+	for _, t := range collect() {
+		b.WriteString("\n")
+		if t == statusType {
+			quoted := make([]string, len(statusNames))
+			for i, name := range statusNames {
+				quoted[i] = fmt.Sprintf("%q", name)
+			}
+			fmt.Fprintf(&b, "export type Status = %s;\n", strings.Join(quoted, " | "))
+			continue
+		}
+		if len(fields(t)) == 0 {
+			fmt.Fprintf(&b, "export interface %s {}\n", t.Name())
+			continue
+		}
+		fmt.Fprintf(&b, "export interface %s {\n", t.Name())
+		for _, f := range fields(t) {
+			optional := ""
+			if f.Optional {
+				optional = "?"
+			}
+			fmt.Fprintf(&b, "  %s%s: %s;\n", f.Name, optional, typeScript(f.Type))
+		}
+		b.WriteString("}\n")
+	}
+	b.WriteString("\n/** A message from the server. */\nexport type Message =")
+	for _, typ := range messageTypes() {
+		fmt.Fprintf(&b, "\n  | { type: %q; message: %s; seq?: number }", typ, typeScript(reflect.TypeOf(Messages[typ])))
+	}
+	b.WriteString(";\n")
+	return b.Bytes()
+}
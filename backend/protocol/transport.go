@@ -0,0 +1,29 @@
+package protocol
+
+import "encoding/json"
+
+// The Server-Sent Events framing the messages of an event stream, besides
+// the unnamed events carrying the messages themselves.
+const (
+	EventSession = "session" // Opens the stream, carrying a Session.
+	EventClose   = "close"   // Ends the stream, carrying a SessionClosed.
+)
+
+// Session tells a client using an HTTP transport the session to POST its messages to,
+// at /transport/{session}, and to poll.
+type Session struct {
+	Session string `json:"session"`
+}
+
+// SessionClosed tells the client why its HTTP session was closed, with a websocket close code.
+type SessionClosed struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// PollResponse is the answer to a poll: the messages from the server since the last one.
+type PollResponse struct {
+	Session  string            `json:"session"`
+	Messages []json.RawMessage `json:"messages"`         // Each is a Message.
+	Closed   *SessionClosed    `json:"closed,omitempty"` // Set once the session is closed and every message fetched.
+}
@@ -4,70 +4,67 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/natsukagami/hakkero-project/backend/protocol"
 )
 
 // MessageQueueResponse represents an user's answer to the queuing request.
 type MessageQueueResponse struct {
-	Accepted bool `json:"accepted"`
-	Received time.Time
-}
-
-// messageQueueFound represents a "Match Found" message.
-type messageQueueFound struct{}
-
-func (m messageQueueFound) IsMessage() {}
-
-// messageQueueAnnouncement represents a "Matchmaking Success/Failed" message.
-type messageQueueAnnouncement struct {
-	Success      bool   `json:"success"`
-	Room         int    `json:"room"`
-	Announcement string `json:"announcement,omitempty"`
+	protocol.QueueResponse
+	Received time.Time `json:"-"`
 }
 
-func (m messageQueueAnnouncement) IsMessage() {}
-
-// messageQueueSize sends any queue size update.
-type messageQueueSize struct {
-	Size int `json:"size"`
-}
-
-func (m messageQueueSize) IsMessage() {}
-
-// messageQueueID announces the player's ID to them.
-type messageQueueID struct {
-	ID string
-}
-
-func (m messageQueueID) IsMessage() {}
-
 // Queue represents a queue handler.
 type Queue struct {
 	Config  Config
 	Rooms   RoomManager
 	OP      OpenSentencer
-	mu      sync.Mutex
-	Players []*QueueConn
+	Ratings *Ratings // The players' ratings. If nil, everyone is rated the same.
+	// The account system. If nil, usernames are not reserved.
+	Accounts *Accounts
+	// The content filter of usernames. If nil, usernames are not filtered.
+	Moderation *Moderation
+	Bans       *Bans    // The banned users. If nil, nobody is banned.
+	Limiter    *Limiter // The flood protection of queue connections. If nil, there is none.
+	mu         sync.Mutex
+	Players    []*QueueConn
 }
 
 // Broadcast sends a message to all audiences.
 func (q *Queue) Broadcast(audience []*QueueConn, m Message) {
-	m.done = make(chan struct{})
+	Broadcast(audience, m)
+}
+
+// Broadcast sends a message to all audiences, waiting for all of them to be done.
+func Broadcast(audience []*QueueConn, m Message) {
+	var wg sync.WaitGroup
 	for _, conn := range audience {
-		go func(conn *QueueConn) { conn.Recv <- m }(conn)
-	}
-	for range audience {
-		<-m.done
+		wg.Add(1)
+		go func(conn *QueueConn) {
+			defer wg.Done()
+			conn.SendMessage(m)
+		}(conn)
 	}
+	wg.Wait()
 }
 
-func (q *Queue) awaitResponse(player *QueueConn, timeout time.Duration) (accept bool, received bool) {
+// awaitResponse waits for the player's answer to a match found at the given time.
+// Messages sent before the match was found are stale, and ignored.
+func (q *Queue) awaitResponse(player *QueueConn, found time.Time, timeout time.Duration) (accept bool, received bool) {
 	timer := time.NewTimer(timeout)
 	defer timer.Stop()
 	for {
 		select {
-		case m := <-player.Send:
+		case m, ok := <-player.Send:
+			if !ok {
+				return false, false
+			}
+			if m.Received.Before(found) {
+				continue
+			}
 			return m.Accepted, true
 		case <-timer.C:
 			return false, false
@@ -75,6 +72,27 @@ func (q *Queue) awaitResponse(player *QueueConn, timeout time.Duration) (accept
 	}
 }
 
+// announceRoom sends each player their assigned room, along with their own token.
+func announceRoom(rooms RoomManager, players []*QueueConn, id int) {
+	var wg sync.WaitGroup
+	for _, player := range players {
+		wg.Add(1)
+		go func(p *QueueConn) {
+			defer wg.Done()
+			p.SendMessage(Message{
+				Type: protocol.TypeAnnouncement,
+				Message: protocol.Announcement{
+					Success:      true,
+					Room:         id,
+					Token:        rooms.Token(id, p.User),
+					Announcement: fmt.Sprintf("You have been assigned to room %d. Match starting soon!", id),
+				},
+			})
+		}(player)
+	}
+	wg.Wait()
+}
+
 func userFromConn(arr []*QueueConn) []User {
 	ans := make([]User, len(arr))
 	for id, conn := range arr {
@@ -87,31 +105,32 @@ func userFromConn(arr []*QueueConn) []User {
 // It returns the players who accepted but not enough for a game.
 func (q *Queue) Play(players []*QueueConn) []*QueueConn {
 	log.Println("starting")
+	found := time.Now()
 	q.Broadcast(players, Message{
-		Type:    "found",
-		Message: messageQueueFound{},
+		Type:    protocol.TypeFound,
+		Message: protocol.Found{},
 	})
 	accepted := make(chan *QueueConn)
 	acceptedArr := make([]*QueueConn, 0)
 	for _, player := range players {
 		go func(p *QueueConn) {
-			accept, received := q.awaitResponse(p, 10*time.Second)
+			accept, received := q.awaitResponse(p, found, 10*time.Second)
 			if accept {
 				accepted <- p
 				return
 			}
 			if !received {
 				p.SendMessage(Message{
-					Type: "announcement",
-					Message: messageQueueAnnouncement{
+					Type: protocol.TypeAnnouncement,
+					Message: protocol.Announcement{
 						Success:      false,
 						Announcement: "You have timed-out a game. Please refresh the page to join again.",
 					},
 				})
 			} else {
 				p.SendMessage(Message{
-					Type: "announcement",
-					Message: messageQueueAnnouncement{
+					Type: protocol.TypeAnnouncement,
+					Message: protocol.Announcement{
 						Success:      false,
 						Announcement: "You have rejected a game. Please refresh the page to join again.",
 					},
@@ -128,11 +147,11 @@ func (q *Queue) Play(players []*QueueConn) []*QueueConn {
 		}
 	}
 	if len(acceptedArr) == len(players) {
-		os, err := q.OP.OpenSentence()
+		os, err := q.OP.OpenSentence(q.Config.Settings.Category)
 		if err != nil {
 			q.Broadcast(acceptedArr, Message{
-				Type: "announcement",
-				Message: messageQueueAnnouncement{
+				Type: protocol.TypeAnnouncement,
+				Message: protocol.Announcement{
 					Success:      false,
 					Announcement: "Cannot find a proper open sentence. Match cancelled!",
 				},
@@ -141,11 +160,11 @@ func (q *Queue) Play(players []*QueueConn) []*QueueConn {
 			return acceptedArr
 		}
 		// New game accepted.
-		id, err := q.Rooms.New(userFromConn(acceptedArr), q.Config.Timeout, os)
+		id, err := q.Rooms.New(userFromConn(acceptedArr), q.Config.Settings, os)
 		if err != nil {
 			q.Broadcast(acceptedArr, Message{
-				Type: "announcement",
-				Message: messageQueueAnnouncement{
+				Type: protocol.TypeAnnouncement,
+				Message: protocol.Announcement{
 					Success:      false,
 					Announcement: "Cannot set up a game room. Match cancelled!",
 				},
@@ -153,19 +172,12 @@ func (q *Queue) Play(players []*QueueConn) []*QueueConn {
 			<-time.After(time.Second)
 			return acceptedArr
 		}
-		q.Broadcast(acceptedArr, Message{
-			Type: "announcement",
-			Message: messageQueueAnnouncement{
-				Success:      true,
-				Room:         id,
-				Announcement: fmt.Sprintf("You have been assigned to room %d. Match starting soon!", id),
-			},
-		})
+		announceRoom(q.Rooms, acceptedArr, id)
 		return nil
 	}
 	q.Broadcast(acceptedArr, Message{
-		Type: "announcement",
-		Message: messageQueueAnnouncement{
+		Type: protocol.TypeAnnouncement,
+		Message: protocol.Announcement{
 			Success:      false,
 			Announcement: "Match cannot start because someone failed the ready check.",
 		},
@@ -173,56 +185,159 @@ func (q *Queue) Play(players []*QueueConn) []*QueueConn {
 	return acceptedArr
 }
 
+// Size returns the number of waiting players.
+func (q *Queue) Size() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.Players)
+}
+
 // Enqueue adds a player into the queue.
 func (q *Queue) Enqueue(player *QueueConn) {
+	// Players coming back from a failed ready check keep their place.
+	if player.Joined.IsZero() {
+		player.Joined = time.Now()
+		player.Rating = NewRating().Value
+		if q.Ratings != nil && player.Registered {
+			player.Rating = q.Ratings.Get(player.Username).Value
+		}
+	}
 	q.mu.Lock()
 	q.Players = append(q.Players, player)
+	q.broadcastSize()
+	log.Println(len(q.Players))
+	q.mu.Unlock()
+	q.match()
+}
+
+// broadcastSize announces the queue size to all waiting players.
+// It must be called with the lock held.
+func (q *Queue) broadcastSize() {
 	q.Broadcast(q.Players, Message{
-		Type: "size",
-		Message: messageQueueSize{
+		Type: protocol.TypeSize,
+		Message: protocol.QueueSize{
 			Size: len(q.Players),
 		},
 	})
-	log.Println(len(q.Players))
-	if len(q.Players) == q.Config.PlayerLimit {
-		nx := q.Play(q.Players)
-		q.Players = make([]*QueueConn, 0)
-		q.mu.Unlock()
-		for _, player := range nx {
-			q.Enqueue(player)
+}
+
+// tolerance returns the rating difference a player accepts after waiting for some time.
+func (q *Queue) tolerance(waited time.Duration) float64 {
+	return q.Config.RatingRange + q.Config.RatingWiden*waited.Seconds()
+}
+
+// pickGroup removes and returns the group of players with the closest ratings,
+// so that every player in the group accepts the rating difference.
+// Returns nil if there is no such group.
+// It must be called with the lock held.
+func (q *Queue) pickGroup(now time.Time) []*QueueConn {
+	n := q.Config.PlayerLimit
+	if len(q.Players) < n {
+		return nil
+	}
+	sorted := make([]*QueueConn, len(q.Players))
+	copy(sorted, q.Players)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Rating < sorted[j].Rating })
+	best, bestSpread := -1, 0.0
+	for i := 0; i+n <= len(sorted); i++ {
+		spread := sorted[i+n-1].Rating - sorted[i].Rating
+		accepted := true
+		for _, p := range sorted[i : i+n] {
+			if spread > q.tolerance(now.Sub(p.Joined)) {
+				accepted = false
+				break
+			}
 		}
-		return
+		if accepted && (best < 0 || spread < bestSpread) {
+			best, bestSpread = i, spread
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	group := sorted[best : best+n]
+	inGroup := make(map[*QueueConn]bool)
+	for _, p := range group {
+		inGroup[p] = true
+	}
+	rest := make([]*QueueConn, 0, len(q.Players)-n)
+	for _, p := range q.Players {
+		if !inGroup[p] {
+			rest = append(rest, p)
+		}
+	}
+	q.Players = rest
+	return group
+}
+
+// match starts a game for the best group of waiting players, if there is one.
+func (q *Queue) match() {
+	q.mu.Lock()
+	group := q.pickGroup(time.Now())
+	if group != nil && len(q.Players) > 0 {
+		q.broadcastSize()
 	}
 	q.mu.Unlock()
+	if group == nil {
+		return
+	}
+	go func() {
+		for _, player := range q.Play(group) {
+			q.Enqueue(player)
+		}
+	}()
+}
+
+// widen periodically retries matching, as the players' tolerance grows while they wait.
+func (q *Queue) widen() {
+	for range time.Tick(time.Second) {
+		q.match()
+	}
 }
 
 func (q *Queue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
-	username := r.FormValue("username")
-	if len(username) == 0 || len(username) > 20 {
-		w.Write([]byte("{\"error\": \"Invalid username\"}"))
-		w.WriteHeader(400)
+	user, err := q.Accounts.Identify(r.FormValue("username"), r.FormValue("session"))
+	if err == nil {
+		user.Username, err = q.Moderation.Username(user.Username)
+	}
+	if err != nil {
+		writeError(w, 400, err)
+		return
+	}
+	if err := q.Bans.Check(user, clientIP(r)); err != nil {
+		writeError(w, 403, err)
+		return
+	}
+	if err := q.Limiter.Connect(clientIP(r)); err != nil {
+		writeError(w, 429, err)
 		return
 	}
-	conn, err := upgrader.Upgrade(w, r, nil)
+	version, err := protocol.Negotiate(r.FormValue("v"))
 	if err != nil {
-		log.Println(err)
+		writeError(w, 400, err)
 		return
 	}
-	pConn := Enqueue(conn, username)
-	q.Broadcast([]*QueueConn{pConn}, Message{
-		Type:    "ID",
-		Message: messageQueueID{ID: pConn.ID},
+	openTransport(w, r, func(t Transport) {
+		pConn := Enqueue(t, user, q.Limiter.Conn(t, clientIP(r)), q.Config.Heartbeat)
+		pConn.SendMessage(helloMessage(version))
+		q.Enqueue(pConn)
 	})
-	q.Enqueue(pConn)
 }
 
 // NewQueue returns a new queue.
-func NewQueue(r RoomManager, c Config, op OpenSentencer) *Queue {
-	return &Queue{
-		Config:  c,
-		Rooms:   r,
-		OP:      op,
-		Players: make([]*QueueConn, 0),
+func NewQueue(r RoomManager, c Config, op OpenSentencer, ratings *Ratings, accounts *Accounts, mod *Moderation, bans *Bans, lim *Limiter) *Queue {
+	q := &Queue{
+		Config:     c,
+		Rooms:      r,
+		OP:         op,
+		Ratings:    ratings,
+		Accounts:   accounts,
+		Moderation: mod,
+		Bans:       bans,
+		Limiter:    lim,
+		Players:    make([]*QueueConn, 0),
 	}
+	go q.widen()
+	return q
 }
@@ -1,10 +1,9 @@
 package backend
 
 import (
+	"log"
 	"time"
 
-	"github.com/gorilla/websocket"
-
 	"github.com/pkg/errors"
 )
 
@@ -12,35 +11,46 @@ import (
 type QueueConn struct {
 	Conn
 	User
-	Send chan MessageQueueResponse
+	Send   chan MessageQueueResponse
+	Joined time.Time // The time the player joined the queue.
+	Rating float64   // The player's rating when they joined.
 }
 
 // forwarder fetches messages from user interface and forwards it to Handler.
 func (q *QueueConn) forwarder() {
-	q.Conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
 	defer close(q.Send)
 	for q.Error == nil {
 		var ms MessageQueueResponse
-		err := q.Conn.ReadJSON(&ms)
+		err := q.ReadJSON(&ms)
 		if err != nil {
 			go q.broadcastError(errors.Wrap(err, "playerconn read"))
 			return
 		}
+		if !q.allow() {
+			return
+		}
+		q.extend()
 		ms.Received = time.Now()
-		q.Send <- ms
+		select {
+		case q.Send <- ms:
+		default:
+			log.Printf("%v: dropped a message, the queue is busy\n", q.RemoteAddr())
+		}
 	}
 }
 
-// Enqueue fires up the QueueConn for usage
-func Enqueue(conn *websocket.Conn, username string) *QueueConn {
+// Enqueue fires up the QueueConn for usage, with the given limit (nil for none) and heartbeat.
+func Enqueue(t Transport, user User, limit *ConnLimit, hb Heartbeat) *QueueConn {
 	q := &QueueConn{
 		Conn: Conn{
-			Conn:    conn,
-			ErrChan: make(chan error)},
-		User: NewUser(username),
+			Transport: t,
+			ErrChan:   make(chan error),
+			limit:     limit},
+		User: user,
 	}
 	q.Recv = make(chan Message)
-	q.Send = make(chan MessageQueueResponse)
+	q.Send = make(chan MessageQueueResponse, sendBuffer)
+	q.keepAlive(hb)
 	go q.forwarder()
 	go q.receiver()
 	return q
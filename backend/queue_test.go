@@ -0,0 +1,56 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueuePickGroup(t *testing.T) {
+	now := time.Now()
+	player := func(name string, rating float64, waited time.Duration) *QueueConn {
+		return &QueueConn{User: User{ID: name, Username: name}, Rating: rating, Joined: now.Add(-waited)}
+	}
+
+	tests := []struct {
+		name    string
+		limit   int
+		players []*QueueConn
+		want    []string // The usernames of the group, by rating; nil if there is none.
+	}{
+		{"too few players", 2, []*QueueConn{player("a", 1500, 0)}, nil},
+		{"close ratings", 2, []*QueueConn{player("a", 1500, 0), player("b", 1550, 0)}, []string{"a", "b"}},
+		{"too far apart", 2, []*QueueConn{player("a", 1500, 0), player("b", 1700, 0)}, nil},
+		{"widened by waiting", 2, []*QueueConn{player("a", 1500, 10*time.Second), player("b", 1700, 10*time.Second)}, []string{"a", "b"}},
+		{"everyone must accept", 2, []*QueueConn{player("a", 1500, time.Minute), player("b", 1700, 0)}, nil},
+		{"closest pair", 2, []*QueueConn{player("a", 1500, 0), player("b", 1580, 0), player("c", 1600, 0)}, []string{"b", "c"}},
+		{"larger group", 3, []*QueueConn{player("a", 1400, 0), player("b", 1800, 0), player("c", 1450, 0), player("d", 1480, 0)}, []string{"a", "c", "d"}},
+	}
+	for _, tt := range tests {
+		q := &Queue{Config: Config{PlayerLimit: tt.limit, RatingRange: 100, RatingWiden: 10}, Players: tt.players}
+		group := q.pickGroup(now)
+		var got []string
+		for _, p := range group {
+			got = append(got, p.Username)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: pickGroup() = %v; want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: pickGroup() = %v; want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+		if len(q.Players) != len(tt.players)-len(group) {
+			t.Errorf("%s: %d players left in the queue; want %d", tt.name, len(q.Players), len(tt.players)-len(group))
+		}
+		for _, p := range q.Players {
+			for _, g := range group {
+				if p == g {
+					t.Errorf("%s: %s was picked but left in the queue", tt.name, p.Username)
+				}
+			}
+		}
+	}
+}
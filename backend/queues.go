@@ -0,0 +1,161 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultMode is the name of the mode using Config.Settings.
+const DefaultMode = "classic"
+
+// queueKey identifies a queue.
+type queueKey struct {
+	Mode    string
+	Players int
+}
+
+// QueueInfo describes a queue and its waiting players.
+type QueueInfo struct {
+	Mode     string       `json:"mode"`
+	Players  int          `json:"players"`
+	Waiting  int          `json:"waiting"`
+	Settings RoomSettings `json:"settings"`
+}
+
+// Queues is a registry of matchmaking queues, keyed by mode and player count.
+// Queues are created as players ask for them.
+type Queues struct {
+	Config   Config
+	Rooms    RoomManager
+	OP       OpenSentencer
+	Ratings  *Ratings
+	Accounts *Accounts
+	// The content filter of usernames. If nil, usernames are not filtered.
+	Moderation *Moderation
+	Bans       *Bans    // The banned users. If nil, nobody is banned.
+	Limiter    *Limiter // The flood protection of queue connections. If nil, there is none.
+	mu         sync.Mutex
+	queues     map[queueKey]*Queue
+}
+
+// Settings returns the room settings of the given mode.
+func (qs *Queues) Settings(mode string) (RoomSettings, bool) {
+	if mode == DefaultMode {
+		return qs.Config.Settings, true
+	}
+	settings, ok := qs.Config.Modes[mode]
+	return settings, ok
+}
+
+// Get returns the queue of the given mode and player count, creating it if needed.
+func (qs *Queues) Get(mode string, players int) (*Queue, error) {
+	settings, ok := qs.Settings(mode)
+	if !ok {
+		return nil, fmt.Errorf("unknown mode %q", mode)
+	}
+	if players < 2 || players > qs.Config.PlayerLimit {
+		return nil, fmt.Errorf("player count must be between 2 and %d", qs.Config.PlayerLimit)
+	}
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	key := queueKey{mode, players}
+	q, ok := qs.queues[key]
+	if !ok {
+		c := qs.Config
+		c.PlayerLimit = players
+		c.Settings = settings
+		q = NewQueue(qs.Rooms, c, qs.OP, qs.Ratings, qs.Accounts, qs.Moderation, qs.Bans, qs.Limiter)
+		qs.queues[key] = q
+	}
+	return q, nil
+}
+
+// List returns the information of all queues, sorted by mode and player count.
+// Every mode is listed at the default player count, even if nobody has asked for it yet.
+func (qs *Queues) List() []QueueInfo {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	list := make([]QueueInfo, 0, len(qs.queues)+len(qs.Config.Modes)+1)
+	for key, q := range qs.queues {
+		list = append(list, QueueInfo{
+			Mode:     key.Mode,
+			Players:  key.Players,
+			Waiting:  q.Size(),
+			Settings: q.Config.Settings,
+		})
+	}
+	modes := []string{DefaultMode}
+	for mode := range qs.Config.Modes {
+		modes = append(modes, mode)
+	}
+	for _, mode := range modes {
+		if _, ok := qs.queues[queueKey{mode, qs.Config.PlayerLimit}]; ok {
+			continue
+		}
+		settings, _ := qs.Settings(mode)
+		list = append(list, QueueInfo{
+			Mode:     mode,
+			Players:  qs.Config.PlayerLimit,
+			Settings: settings,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Mode != list[j].Mode {
+			return list[i].Mode < list[j].Mode
+		}
+		return list[i].Players < list[j].Players
+	})
+	return list
+}
+
+// ServeHTTP forwards the connection to the queue chosen by the "mode" and "players" parameters.
+// They default to DefaultMode and Config.PlayerLimit.
+func (qs *Queues) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	mode := r.FormValue("mode")
+	if mode == "" {
+		mode = DefaultMode
+	}
+	players := qs.Config.PlayerLimit
+	if p := r.FormValue("players"); p != "" {
+		var err error
+		if players, err = strconv.Atoi(p); err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte("{\"error\": \"Invalid player count\"}"))
+			return
+		}
+	}
+	q, err := qs.Get(mode, players)
+	if err != nil {
+		data, _ := json.Marshal(map[string]string{"error": err.Error()})
+		w.WriteHeader(400)
+		w.Write(data)
+		return
+	}
+	q.ServeHTTP(w, r)
+}
+
+// serveList lists all queues.
+func (qs *Queues) serveList(w http.ResponseWriter, r *http.Request) {
+	data, _ := json.Marshal(qs.List())
+	w.Write(data)
+}
+
+// NewQueues returns a new queue registry.
+func NewQueues(r RoomManager, c Config, op OpenSentencer, ratings *Ratings, accounts *Accounts, mod *Moderation, bans *Bans, lim *Limiter) *Queues {
+	return &Queues{
+		Config:     c,
+		Rooms:      r,
+		OP:         op,
+		Ratings:    ratings,
+		Accounts:   accounts,
+		Moderation: mod,
+		Bans:       bans,
+		Limiter:    lim,
+		queues:     make(map[queueKey]*Queue),
+	}
+}
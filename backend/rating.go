@@ -0,0 +1,146 @@
+package backend
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sync"
+)
+
+// initialRating is the rating of a new player.
+const initialRating = 1500
+
+// ratingK is the maximum rating change of a single game.
+const ratingK = 32
+
+// Rating is a player's Elo-style skill rating.
+type Rating struct {
+	Value float64 `json:"rating"`
+	Games int     `json:"games"` // The number of rated games played.
+}
+
+// NewRating returns the rating of a new player.
+func NewRating() Rating {
+	return Rating{Value: initialRating}
+}
+
+// ErrRated is returned when saving the ratings of a game that was already rated.
+var ErrRated = errors.New("the game has already been rated")
+
+// RatingStore represents a storage of the players' ratings, keyed by username.
+type RatingStore interface {
+	// Get returns the player's rating, or NewRating() if they have none.
+	Get(name string) (Rating, error)
+	// Put saves the players' ratings after the game in the given room, all at once.
+	// Each game is rated once: if the room was already rated, nothing is saved and ErrRated is returned.
+	Put(room int, ratings map[string]Rating) error
+}
+
+type memoryRatings struct {
+	mu      sync.RWMutex
+	ratings map[string]Rating
+	rated   map[int]bool
+}
+
+func (m *memoryRatings) Get(name string) (Rating, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if r, ok := m.ratings[name]; ok {
+		return r, nil
+	}
+	return NewRating(), nil
+}
+
+func (m *memoryRatings) Put(room int, ratings map[string]Rating) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rated[room] {
+		return ErrRated
+	}
+	m.rated[room] = true
+	for name, r := range ratings {
+		m.ratings[name] = r
+	}
+	return nil
+}
+
+// MemoryRatings returns a RatingStore that keeps everything in memory.
+func MemoryRatings() RatingStore {
+	return &memoryRatings{ratings: make(map[string]Rating), rated: make(map[int]bool)}
+}
+
+// Ratings computes and keeps the players' ratings.
+type Ratings struct {
+	mu    sync.Mutex // Serializes updates.
+	Store RatingStore
+}
+
+// Get returns the player's rating.
+func (rs *Ratings) Get(name string) Rating {
+	r, err := rs.Store.Get(name)
+	if err != nil {
+		log.Printf("Rating of %s: %v\n", name, err)
+		return NewRating()
+	}
+	return r
+}
+
+// Ranks returns the finishing position of each member, 0 being the best.
+// Players who were never out share the first place, the others are ranked
+// by the order in which they went out.
+func (r Room) Ranks() []int {
+	ranks := make([]int, len(r.Members))
+	for pos, id := range r.Out {
+		ranks[id] = len(r.Out) - pos
+	}
+	return ranks
+}
+
+// Update updates the ratings of the members of a finished game, comparing
+// every pair of members by their finishing position. Only registered members
+// are rated, as anyone can play under an unregistered username; the others
+// count as new players. A game is only rated once, even if its end is replayed
+// after a crash.
+func (rs *Ratings) Update(room Room) {
+	n := len(room.Members)
+	if n < 2 {
+		return
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	ranks := room.Ranks()
+	before := make([]Rating, n)
+	for id, member := range room.Members {
+		before[id] = NewRating()
+		if member.Registered {
+			before[id] = rs.Get(member.Username)
+		}
+	}
+	after := make(map[string]Rating)
+	for i, member := range room.Members {
+		if !member.Registered {
+			continue
+		}
+		delta := 0.0
+		for j := range room.Members {
+			if i == j {
+				continue
+			}
+			expected := 1 / (1 + math.Pow(10, (before[j].Value-before[i].Value)/400))
+			score := 0.5
+			if ranks[i] < ranks[j] {
+				score = 1
+			} else if ranks[i] > ranks[j] {
+				score = 0
+			}
+			delta += score - expected
+		}
+		after[member.Username] = Rating{
+			Value: before[i].Value + ratingK*delta/float64(n-1),
+			Games: before[i].Games + 1,
+		}
+	}
+	if err := rs.Store.Put(room.ID, after); err != nil {
+		log.Printf("Ratings of room %d: %v\n", room.ID, err)
+	}
+}
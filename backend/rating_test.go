@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRatingsUpdate(t *testing.T) {
+	alice := User{ID: "a", Username: "alice", Registered: true}
+	bob := User{ID: "b", Username: "bob", Registered: true}
+	carol := User{ID: "c", Username: "carol", Registered: true}
+	guest := User{ID: "g", Username: "guest"}
+
+	tests := []struct {
+		name    string
+		members []User
+		out     []int
+		before  map[string]Rating
+		want    map[string]Rating // The ratings of the players not listed must stay unset.
+	}{
+		{"win between equals", []User{alice, bob}, []int{1}, nil,
+			map[string]Rating{"alice": {1516, 1}, "bob": {1484, 1}}},
+		{"draw", []User{alice, bob}, nil, nil,
+			map[string]Rating{"alice": {1500, 1}, "bob": {1500, 1}}},
+		{"three players", []User{alice, bob, carol}, []int{2, 1}, nil,
+			map[string]Rating{"alice": {1516, 1}, "bob": {1500, 1}, "carol": {1484, 1}}},
+		{"favourite wins", []User{alice, bob}, []int{1}, map[string]Rating{"alice": {1600, 10}, "bob": {1400, 3}},
+			map[string]Rating{"alice": {1607.69, 11}, "bob": {1392.31, 4}}},
+		{"underdog wins", []User{alice, bob}, []int{0}, map[string]Rating{"alice": {1600, 10}, "bob": {1400, 3}},
+			map[string]Rating{"alice": {1575.69, 11}, "bob": {1424.31, 4}}},
+		{"guests are not rated", []User{alice, guest}, []int{1}, nil,
+			map[string]Rating{"alice": {1516, 1}}},
+		{"alone", []User{alice}, nil, nil, map[string]Rating{}},
+	}
+	for _, tt := range tests {
+		store := MemoryRatings()
+		if tt.before != nil {
+			store.Put(-1, tt.before)
+		}
+		rs := &Ratings{Store: store}
+		room := Room{ID: 1, Members: tt.members, Out: tt.out}
+		rs.Update(room)
+		// Replaying the end of the game must not rate it again.
+		rs.Update(room)
+		for _, member := range []User{alice, bob, carol, guest} {
+			want, ok := tt.want[member.Username]
+			if !ok {
+				want = tt.before[member.Username]
+				if want == (Rating{}) {
+					want = NewRating()
+				}
+			}
+			got := rs.Get(member.Username)
+			if math.Abs(got.Value-want.Value) > 0.01 || got.Games != want.Games {
+				t.Errorf("%s: rating of %s = %+v; want %+v", tt.name, member.Username, got, want)
+			}
+		}
+	}
+}
+
+func TestRatingStorePut(t *testing.T) {
+	stores := []struct {
+		name  string
+		store RatingStore
+	}{
+		{"memory", MemoryRatings()},
+		{"bolt", testBolt(t).Ratings()},
+	}
+	tests := []struct {
+		name  string
+		room  int
+		value float64
+		err   error
+	}{
+		{"first", 1, 1510, nil},
+		{"another room", 2, 1520, nil},
+		{"rated again", 1, 1530, ErrRated},
+	}
+	for _, s := range stores {
+		if r, err := s.store.Get("alice"); r != NewRating() || err != nil {
+			t.Errorf("%s: Get() of a new player = %+v, %v; want %+v, nil", s.name, r, err, NewRating())
+		}
+		for _, tt := range tests {
+			err := s.store.Put(tt.room, map[string]Rating{"alice": {tt.value, 1}})
+			if err != tt.err {
+				t.Errorf("%s: %s: Put() = %v; want %v", s.name, tt.name, err, tt.err)
+			}
+		}
+		if r, _ := s.store.Get("alice"); r.Value != 1520 {
+			t.Errorf("%s: Get() = %+v; want the rating of the last rated room", s.name, r)
+		}
+	}
+}
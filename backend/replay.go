@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxReplaySpeed caps the replay acceleration.
+const maxReplaySpeed = 64
+
+// maxReplayGap caps the pause between two events, before acceleration. Longer pauses,
+// such as the wait before the game, idle turns or server downtime, are shortened to it.
+const maxReplayGap = 10 * time.Second
+
+// events returns a copy of the event log.
+func (h *RoomHandler) events() []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Event(nil), h.Room.Events...)
+}
+
+// serveReplay streams the room's event log through a websocket, keeping the
+// original pace between events, up to maxReplayGap, accelerated by the "speed" parameter.
+// Visitors who may not follow the game are refused.
+func (h *RoomHandler) serveReplay(w http.ResponseWriter, r *http.Request, v visitor) {
+	if !h.visible(v) {
+		writeError(w, 403, errNoSpectators)
+		return
+	}
+	speed, err := strconv.ParseFloat(r.FormValue("speed"), 64)
+	if err != nil || speed <= 0 {
+		speed = 1
+	}
+	if speed > maxReplaySpeed {
+		speed = maxReplaySpeed
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	// Nothing is expected from the spectator, but reading is needed to notice them leaving.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	events := h.events()
+	for id, ev := range events {
+		if id > 0 {
+			gap := ev.Time.Sub(events[id-1].Time)
+			if gap > maxReplayGap {
+				gap = maxReplayGap
+			}
+			delay := time.Duration(float64(gap) / speed)
+			select {
+			case <-time.After(delay):
+			case <-gone:
+				return
+			}
+		}
+		if err := conn.WriteJSON(&ev); err != nil {
+			log.Printf("Room %d replay: %v\n", h.Room.ID, err)
+			return
+		}
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "replay ended"))
+}
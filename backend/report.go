@@ -0,0 +1,220 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/natsukagami/hakkero-project/backend/protocol"
+)
+
+// maxReportReason caps the length of a report's reason, in characters.
+const maxReportReason = 500
+
+// ReportStatus is the review status of a report.
+type ReportStatus string
+
+// ReportStatus constants.
+const (
+	ReportPending   ReportStatus = "pending"
+	ReportAccepted  ReportStatus = "accepted"
+	ReportDismissed ReportStatus = "dismissed"
+)
+
+// Report is a complaint about a sentence or a member, sent by a player or a spectator
+// as a protocol.Report, along with what operators need to review it. The content
+// filter also files reports about the content it flags.
+type Report struct {
+	ID         int          `json:"id"` // The index of the report in the room.
+	Sentence   *int         `json:"sentence,omitempty"`
+	Member     *int         `json:"member,omitempty"`
+	Reason     string       `json:"reason"`
+	Reporter   string       `json:"reporter"`         // The reporter's username, or empty for spectators and the content filter.
+	System     bool         `json:"system,omitempty"` // Whether the content filter filed the report.
+	Target     string       `json:"target"`           // The reported member's username.
+	Registered bool         `json:"registered"`       // Whether the reported member is registered, and can be banned by account.
+	TargetIP   string       `json:"targetIP,omitempty"`
+	Time       time.Time    `json:"time"`
+	Status     ReportStatus `json:"status"`
+}
+
+// target returns the index of the member the report is about.
+func (r Room) target(rp Report) (int, error) {
+	switch {
+	case rp.Sentence != nil && rp.Member == nil:
+		pos := *rp.Sentence
+		if pos < 0 || pos >= len(r.Sentences) || r.Sentences[pos].System {
+			return 0, errors.New("sentence not found")
+		}
+		return r.Sentences[pos].Owner, nil
+	case rp.Member != nil && rp.Sentence == nil:
+		if *rp.Member < 0 || *rp.Member >= len(r.Members) {
+			return 0, errors.New("member not found")
+		}
+		return *rp.Member, nil
+	}
+	return 0, errors.New("a report is about either a sentence or a member")
+}
+
+// connIP returns the address of the connection's client.
+func connIP(conn *PlayerConn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// report files a report from the member at index, or a guest if negative.
+// Reports are kept whatever the state of the game: they go through the game loop
+// while it runs, and are filed right away once the game has ended.
+func (h *RoomHandler) report(index int, conn *PlayerConn, req protocol.Report) {
+	var (
+		id  int
+		err error
+	)
+	file := func() bool {
+		if id, err = h.addReport(index, conn, req); err == nil {
+			h.save()
+		}
+		return false
+	}
+	if h.control(file) == ErrGameEnded {
+		// Nothing else writes to an ended room.
+		file()
+	}
+	if err != nil {
+		conn.SendMessage(Message{
+			Type:    protocol.TypeRejected,
+			Message: protocol.Rejected{Reason: err.Error()},
+		})
+		return
+	}
+	log.Printf("Room %d: report %d filed\n", h.Room.ID, id)
+	conn.SendMessage(Message{
+		Type:    protocol.TypeReported,
+		Message: protocol.Reported{ID: id},
+	})
+}
+
+// addReport validates and appends the report to the Room, returning its ID.
+func (h *RoomHandler) addReport(index int, conn *PlayerConn, req protocol.Report) (int, error) {
+	rp := Report{Sentence: req.Sentence, Member: req.Member, Reason: strings.TrimSpace(req.Reason)}
+	if rp.Reason == "" || utf8.RuneCountInString(rp.Reason) > maxReportReason {
+		return 0, fmt.Errorf("the reason must have between 1 and %d characters", maxReportReason)
+	}
+	target, err := h.Room.target(rp)
+	if err != nil {
+		return 0, err
+	}
+	if target == index {
+		return 0, errors.New("you cannot report yourself")
+	}
+	rp.Target = h.Room.Members[target].Username
+	rp.Registered = h.Room.Members[target].Registered
+	if tconn, ok := h.p.Get(h.Room.Members[target].ID); ok {
+		rp.TargetIP = connIP(tconn)
+	}
+	if index >= 0 {
+		rp.Reporter = h.Room.Members[index].Username
+	}
+	rp.Time = time.Now()
+	rp.Status = ReportPending
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, other := range h.Room.Reports {
+		// Spectators are not told apart, so only members' duplicates are caught.
+		if index >= 0 && other.Reporter == rp.Reporter && other.Target == rp.Target && samePos(other.Sentence, rp.Sentence) {
+			return 0, errors.New("you have already reported this")
+		}
+	}
+	rp.ID = len(h.Room.Reports)
+	h.Room.Reports = append(h.Room.Reports, rp)
+	return rp.ID, nil
+}
+
+// flag files a report from the content filter, about a flagged sentence or username.
+func (h *RoomHandler) flag(rp Report) {
+	target, err := h.Room.target(rp)
+	if err != nil {
+		return
+	}
+	rp.Reason = "flagged by the content filter"
+	rp.Target = h.Room.Members[target].Username
+	rp.Registered = h.Room.Members[target].Registered
+	if tconn, ok := h.p.Get(h.Room.Members[target].ID); ok {
+		rp.TargetIP = connIP(tconn)
+	}
+	rp.System = true
+	rp.Time = time.Now()
+	rp.Status = ReportPending
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rp.ID = len(h.Room.Reports)
+	h.Room.Reports = append(h.Room.Reports, rp)
+}
+
+// samePos returns whether both are unset, or set to the same position.
+func samePos(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// Review sets the status of a pending report, returning the reviewed report.
+// Like reports, reviews go through the game loop while it runs.
+func (h *RoomHandler) Review(id int, status ReportStatus) (Report, error) {
+	var (
+		rp  Report
+		err error
+	)
+	review := func() bool {
+		h.mu.Lock()
+		switch {
+		case id < 0 || id >= len(h.Room.Reports):
+			err = errors.New("report not found")
+		case h.Room.Reports[id].Status != ReportPending:
+			err = errors.New("the report has already been reviewed")
+		default:
+			h.Room.Reports[id].Status = status
+			rp = h.Room.Reports[id]
+		}
+		h.mu.Unlock()
+		if err == nil {
+			h.save()
+		}
+		return false
+	}
+	if h.control(review) == ErrGameEnded {
+		// Nothing else writes to an ended room.
+		review()
+	}
+	return rp, err
+}
+
+// PendingReport is a report waiting for review, with its room.
+type PendingReport struct {
+	Room int `json:"room"`
+	Report
+}
+
+// PendingReports returns the reports waiting for review, from every room in the store.
+func PendingReports(store RoomStore) ([]PendingReport, error) {
+	list := make([]PendingReport, 0)
+	err := store.Each(func(room Room) error {
+		for _, rp := range room.Reports {
+			if rp.Status == ReportPending {
+				list = append(list, PendingReport{Room: room.ID, Report: rp})
+			}
+		}
+		return nil
+	})
+	return list, err
+}
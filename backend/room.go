@@ -3,60 +3,112 @@ package backend
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 	"time"
+
+	"github.com/natsukagami/hakkero-project/backend/protocol"
 )
 
 // Status represents a player's status in a room.
-type Status int
+type Status = protocol.Status
 
 // Status constants.
 const (
-	StatusActive Status = iota
-	StatusOut
-	StatusDc
-	StatusTurn
+	StatusActive = protocol.StatusActive
+	StatusOut    = protocol.StatusOut
+	StatusDc     = protocol.StatusDc
+	StatusTurn   = protocol.StatusTurn
 )
 
-// MarshalJSON returns the status of the player in JSON.
-// Numbers are not the pretty thing, we send status strings instead.
-func (s Status) MarshalJSON() ([]byte, error) {
-	var st string
-	switch s {
-	case StatusActive:
-		st = "active"
-	case StatusOut:
-		st = "skipped"
-	case StatusDc:
-		st = "disconnected"
-	case StatusTurn:
-		st = "turn"
-	default:
-		st = "unknown"
-	}
-	return json.Marshal(st)
-}
-
 // Room represents a playing Room.
 type Room struct {
-	ID        int           `json:"id"`
-	Members   []User        `json:"members"`           // The list of all members.
-	Status    []Status      `json:"status"`            // The status of each member in the room.
-	Sentences []Sentence    `json:"sentences"`         // The list of all sentences.
-	Start     time.Time     `json:"start"`             // The time of the start of the game.
-	Current   time.Time     `json:"current,omitempty"` // The time when the current turn started.
-	Timeout   time.Duration `json:"timeout"`           // The time of each turn.
+	ID        int          `json:"id"`
+	Members   []User       `json:"members"`           // The list of all members.
+	Status    []Status     `json:"status"`            // The status of each member in the room.
+	Sentences []Sentence   `json:"sentences"`         // The list of all sentences.
+	Start     time.Time    `json:"start"`             // The time of the start of the game.
+	Current   time.Time    `json:"current,omitempty"` // The time when the current turn started.
+	Settings  RoomSettings `json:"settings"`          // The rules of the game.
+	Turn      int          `json:"turn"`              // The index of the member whose turn is the current one.
+	Round     int          `json:"round"`             // The number of rounds that have passed.
+	Skips     []int        `json:"skips"`             // The number of skips each member has made.
+	Out       []int        `json:"out"`               // The members who are out, in the order they went out.
+	Private   bool         `json:"private"`           // Private rooms are created from lobbies, and are not publicly listed.
+	Votes     []int        `json:"votes,omitempty"`   // The votes each member received, if the room voted.
+	Finished  bool         `json:"finished"`          // Whether the end of the game has been announced and recorded.
+	Reports   []Report     `json:"-"`                 // The reports of players and spectators, for the operators.
+	Events    []Event      `json:"-"`                 // The log of every broadcast message, for replays.
 }
 
-// Ended returns whether the game has ended.
-func (r Room) Ended() bool {
-	// Simply put, the game ended if and only if only one player is active.
+// Event is a logged broadcast message.
+type Event struct {
+	Seq  int             `json:"seq"`
+	Time time.Time       `json:"time"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"message"`
+}
+
+// active returns the number of active players.
+func (r Room) active() int {
 	active := 0
 	for _, status := range r.Status {
 		if status == StatusActive || status == StatusTurn {
 			active++
 		}
 	}
-	return active == 1
+	return active
+}
+
+// Ended returns whether the game has ended.
+func (r Room) Ended() bool {
+	// Simply put, the game ended if and only if only one player is active,
+	// or any of the limits has been reached.
+	switch {
+	case r.Settings.MaxRounds > 0 && r.Round >= r.Settings.MaxRounds:
+		return true
+	case r.Settings.WordBudget > 0 && r.Words() >= r.Settings.WordBudget:
+		return true
+	case r.Settings.Duration > 0 && !time.Now().Before(r.Deadline()):
+		return true
+	}
+	return r.active() == 1
+}
+
+// Words returns the number of words the players have written.
+func (r Room) Words() int {
+	words := 0
+	for _, sent := range r.Sentences {
+		if !sent.System {
+			words += len(strings.Fields(sent.Content))
+		}
+	}
+	return words
+}
+
+// Deadline returns the time the game ends, if it has a duration.
+func (r Room) Deadline() time.Time {
+	return r.Start.Add(r.Settings.Duration)
+}
+
+// Progress reports how far the game is from its limits.
+type Progress = protocol.Progress
+
+// Progress returns the progress of the game toward its limits.
+func (r Room) Progress() Progress {
+	var p Progress
+	if r.Settings.MaxRounds > 0 {
+		left := max(r.Settings.MaxRounds-r.Round, 0)
+		p.RoundsLeft = &left
+	}
+	if r.Settings.WordBudget > 0 {
+		left := max(r.Settings.WordBudget-r.Words(), 0)
+		p.WordsLeft = &left
+	}
+	if r.Settings.Duration > 0 {
+		deadline := r.Deadline()
+		p.Deadline = &deadline
+	}
+	return p
 }
 
 // Index returns a player's index in the slice.
@@ -70,6 +122,17 @@ func (r Room) Index(ID string) (int, error) {
 	return 0, errors.New("player not found")
 }
 
+// AccountIndex returns the index of the registered player with the given username.
+// Throws an error if it's not found.
+func (r Room) AccountIndex(username string) (int, error) {
+	for id, user := range r.Members {
+		if user.Registered && user.Username == username {
+			return id, nil
+		}
+	}
+	return 0, errors.New("player not found")
+}
+
 // NextTurn returns the next turn and DOES NOT modifies the current status.
 // Returns true if game ended.
 func (r Room) NextTurn(last int) (int, bool) {
@@ -85,8 +148,11 @@ func (r Room) NextTurn(last int) (int, bool) {
 	}
 }
 
-// Winner returns the winner.
+// Winner returns the winner, or -1 if there is no single survivor.
 func (r Room) Winner() int {
+	if r.active() != 1 {
+		return -1
+	}
 	for id, st := range r.Status {
 		if st == StatusActive || st == StatusTurn {
 			return id
@@ -94,3 +160,62 @@ func (r Room) Winner() int {
 	}
 	return -1
 }
+
+// Ballot is a vote for a favourite sentence or author.
+type Ballot = protocol.Ballot
+
+// ValidBallot checks whether the member at index, or a guest if index is negative,
+// can cast the ballot. Members cannot vote for themselves.
+func (r Room) ValidBallot(index int, b Ballot) bool {
+	switch {
+	case b.Sentence != nil && b.Author == nil:
+		pos := *b.Sentence
+		return pos >= 0 && pos < len(r.Sentences) && !r.Sentences[pos].System && r.Sentences[pos].Owner != index
+	case b.Author != nil && b.Sentence == nil:
+		author := *b.Author
+		return author >= 0 && author < len(r.Members) && author != index
+	}
+	return false
+}
+
+// VoteWinner returns the member with the most votes, or -1 if there is no single one.
+func (r Room) VoteWinner() int {
+	winner, best := -1, 0
+	for id, votes := range r.Votes {
+		switch {
+		case votes > best:
+			winner, best = id, votes
+		case votes == best:
+			winner = -1
+		}
+	}
+	return winner
+}
+
+// redactedContent replaces the content of redacted sentences.
+const redactedContent = "[removed]"
+
+// Redact removes the content of a sentence, from both the story and the event log.
+func (r *Room) Redact(pos int) error {
+	if pos < 0 || pos >= len(r.Sentences) {
+		return errors.New("sentence not found")
+	}
+	r.Sentences[pos].Content = redactedContent
+	r.Sentences[pos].Redacted = true
+	for id, ev := range r.Events {
+		if ev.Type != "sentence" {
+			continue
+		}
+		var m protocol.NewSentence
+		if err := json.Unmarshal(ev.Data, &m); err != nil || m.Pos != pos {
+			continue
+		}
+		m.Sentence = r.Sentences[pos]
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		r.Events[id].Data = data
+	}
+	return nil
+}
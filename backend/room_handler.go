@@ -3,63 +3,75 @@ package backend
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
-)
 
-// The following message types are for communication by channels.
+	"github.com/natsukagami/hakkero-project/backend/protocol"
+)
 
-// messageIndex announces their own position on the board.
-type messageIndex struct {
-	Index int `json:"index"`
+// endMessage returns the end message of the Room.
+func (r Room) endMessage() protocol.End {
+	m := protocol.End{Winner: r.Winner(), VoteWinner: r.VoteWinner()}
+	if r.Votes != nil {
+		m.Votes = r.Votes
+		m.SentenceVotes = make([]int, len(r.Sentences))
+		for pos, sent := range r.Sentences {
+			m.SentenceVotes[pos] = sent.Votes
+		}
+	}
+	return m
 }
 
-func (messageIndex) IsMessage() {}
+// MessageRequest is a player's response.
+type MessageRequest struct {
+	protocol.Request
+	Received time.Time `json:"-"`
+}
 
-// messageTurn contains the current turn's status, and the next turn's index and clock time.
-type messageTurn struct {
-	Status []Status  `json:"status"`
-	Time   time.Time `json:"current"`
+// request is a MessageRequest received from one of the room's connections.
+type request struct {
+	MessageRequest
+	index int // The member index of the sender, or -1 for guests.
+	conn  *PlayerConn
 }
 
-func (messageTurn) IsMessage() {}
+// Messager is the payload of a Message.
+type Messager = protocol.Payload
 
-// messageSentence contains the information of an occurring next sentence.
-type messageSentence struct {
-	Sentence `json:"sentence"`
-	Pos      int `json:"pos"` // The position in the slice. Maybe it could be sent not in order?
+// Message is the general message type we will use in sending-channels.
+// It is sent as a protocol.Message.
+type Message struct {
+	Type    string   `json:"type"`
+	Message Messager `json:"message"`
+	Seq     *int     `json:"seq,omitempty"` // The position in the room's event log, set on broadcasts.
+	done    chan struct{}
 }
 
-func (messageSentence) IsMessage() {}
-
-// messageEnd passes the End indicator.
-type messageEnd struct {
-	Winner int // Index of the winner.
+// helloMessage opens a connection speaking the protocol version.
+func helloMessage(version int) Message {
+	return Message{Type: protocol.TypeHello, Message: protocol.Hello{Version: version}}
 }
 
-func (messageEnd) IsMessage() {}
+// messageLogged is an already encoded message, resent from the event log.
+type messageLogged json.RawMessage
 
-// MessageRequest is a player's response.
-type MessageRequest struct {
-	IsSkip   bool `json:"skip"` // Whether the player has skipped.
-	Received time.Time
-	Content  string `json:"content"`
-}
+func (messageLogged) IsMessage() {}
 
-// Messager is an internal interface, to help type safety with general message-typing.
-type Messager interface {
-	IsMessage()
+// MarshalJSON returns the encoded message.
+func (m messageLogged) MarshalJSON() ([]byte, error) {
+	return m, nil
 }
 
-// Message is the general message type we will use in sending-channels.
-type Message struct {
-	Type    string   `json:"type"`
-	Message Messager `json:"message"`
-	done    chan struct{}
+// message returns the logged message, to be sent again.
+func (ev Event) message() Message {
+	seq := ev.Seq
+	return Message{Type: ev.Type, Message: messageLogged(ev.Data), Seq: &seq}
 }
 
 type pconnMap struct {
@@ -87,16 +99,30 @@ func (p *pconnMap) Guest(conn *PlayerConn) {
 	p.Guests = append(p.Guests, conn)
 }
 
+// Send queues the message to every connection.
 func (p *pconnMap) Send(m Message) {
-	sender := func(conn *PlayerConn) { conn.SendMessage(m) }
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	for _, conn := range p.Conns {
-		go sender(conn)
+		conn.push(m)
+	}
+	for _, conn := range p.Guests {
+		conn.push(m)
+	}
+}
+
+// CloseAll closes every connection and forgets about them.
+func (p *pconnMap) CloseAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, conn := range p.Conns {
+		delete(p.Conns, id)
+		conn.Close()
 	}
 	for _, conn := range p.Guests {
-		go sender(conn)
+		conn.Close()
 	}
+	p.Guests = nil
 }
 
 // RoomHandler is a Handler that serves players' connections to Room server.
@@ -105,82 +131,373 @@ type RoomHandler struct {
 	// internal variables
 	p         pconnMap
 	ctx       context.Context
-	TurnTimer *time.Timer // The turn timer.
+	store     RoomStore
+	onEnd     func(Room)           // Called with the final snapshot when the game ends.
+	mod       *Moderation          // The content filter of sentences.
+	inbox     chan request         // The requests from every connection.
+	controls  chan func() bool     // Operator actions, run by the game loop. They return whether the turn ends.
+	mu        sync.Mutex           // Guards Room.Events, voting and grace, which are accessed from both the game and the connections.
+	voting    *protocol.Vote       // The open voting phase, if any.
+	grace     time.Duration        // The time disconnected players have to reconnect, from the connections' heartbeat.
+	kickVotes map[int]map[int]bool // The members voting to kick each member. Only used by the game loop.
+	TurnTimer *time.Timer          // The turn timer.
+}
+
+// Done returns a channel that is closed when the game has ended.
+func (h *RoomHandler) Done() <-chan struct{} {
+	return h.ctx.Done()
+}
+
+// Close closes all remaining connections to the room.
+// It should only be called after the game has ended.
+func (h *RoomHandler) Close() {
+	h.p.CloseAll()
+}
+
+// save writes the current Room snapshot into the store.
+func (h *RoomHandler) save() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.store.Save(h.Room); err != nil {
+		log.Printf("Room %d: cannot save: %v\n", h.Room.ID, err)
+	}
 }
 
-// Broadcast sends the message to all listening PlayerConns.
-// It pauses until all messages are scheduled to send.
+// Broadcast logs the message, numbering it, then queues it to all listening PlayerConns.
+// Logging and queueing happen at once, so that resuming connections neither miss nor repeat a message.
 func (h *RoomHandler) Broadcast(m Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	data, err := json.Marshal(m.Message)
+	if err != nil {
+		log.Printf("Room %d: cannot log %s: %v\n", h.Room.ID, m.Type, err)
+	} else {
+		seq := len(h.Room.Events)
+		m.Seq = &seq
+		h.Room.Events = append(h.Room.Events, Event{
+			Seq:  seq,
+			Time: time.Now(),
+			Type: m.Type,
+			Data: data,
+		})
+	}
 	h.p.Send(m)
 }
 
-// AddSentence adds a valid sentence into the Room.
-func (h *RoomHandler) addSentence(id int, Content string) {
+// attach registers the connection, under the player's ID or as a guest if empty.
+// If since is not negative, the logged messages from that sequence number on are queued first.
+func (h *RoomHandler) attach(ID string, conn *PlayerConn, since int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if since >= 0 && since < len(h.Room.Events) {
+		for _, ev := range h.Room.Events[since:] {
+			conn.push(ev.message())
+		}
+	}
+	if ID == "" {
+		h.p.Guest(conn)
+	} else {
+		h.p.Set(ID, conn)
+	}
+}
+
+// reconnectGrace returns the time disconnected players have to reconnect.
+func (h *RoomHandler) reconnectGrace() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.grace
+}
+
+// watch announces the player's disconnection, unless they have reconnected since.
+// If they do not reconnect within the grace period (if not zero), they are out of the game.
+func (h *RoomHandler) watch(index int, conn *PlayerConn, grace time.Duration) {
+	select {
+	case <-conn.ErrChan:
+	case <-h.ctx.Done():
+		return
+	}
+	ID := h.Room.Members[index].ID
+	if current, ok := h.p.Get(ID); !ok || current != conn {
+		return
+	}
+	h.Broadcast(Message{
+		Type:    protocol.TypeDisconnect,
+		Message: protocol.Disconnect{Index: index},
+	})
+	if grace <= 0 {
+		return
+	}
+	select {
+	case <-time.After(grace):
+	case <-h.ctx.Done():
+		return
+	}
+	if current, ok := h.p.Get(ID); !ok || current != conn {
+		return
+	}
+	h.control(func() bool {
+		// The game may have ended meanwhile, and only be voting.
+		if !h.Room.isActive(index) || h.Room.Ended() {
+			return false
+		}
+		return h.remove(index, StatusDc, fmt.Sprintf("Player `%s` has disconnected.", h.Room.Members[index].Username))
+	})
+}
+
+// pump forwards the connection's requests into the inbox, until the connection closes.
+// Requests arriving after the game has ended are dropped, except for reports.
+func (h *RoomHandler) pump(index int, conn *PlayerConn) {
+	for req := range conn.Send {
+		if req.Report != nil {
+			h.report(index, conn, *req.Report)
+			continue
+		}
+		select {
+		case h.inbox <- request{MessageRequest: req, index: index, conn: conn}:
+		case <-h.ctx.Done():
+		}
+	}
+}
+
+// AddSentence adds a valid sentence into the Room, after going through the content filter.
+// Returns ErrFiltered if the filter rejects it.
+func (h *RoomHandler) addSentence(id int, Content string) error {
+	Content, flagged, err := h.mod.Check(Content)
+	if err != nil {
+		return err
+	}
 	h.Room.Status[id] = StatusActive
 	sent := Sentence{
 		Owner:   id,
 		Content: Content,
+		Flagged: flagged,
 	}
 	h.Room.Sentences = append(h.Room.Sentences, sent)
+	pos := len(h.Room.Sentences) - 1
 	h.Broadcast(Message{
-		Type: "sentence",
-		Message: messageSentence{
+		Type: protocol.TypeSentence,
+		Message: protocol.NewSentence{
 			Sentence: sent,
-			Pos:      len(h.Room.Sentences) - 1,
+			Pos:      pos,
 		},
 	})
+	if flagged {
+		h.flag(Report{Sentence: &pos})
+	}
+	return nil
 }
 
 // addSkip adds a system skip announcement into the Room.
+// Players are out on their first skip beyond the allowed ones.
 func (h *RoomHandler) addSkip(id int, isSkip bool) {
-	sent := Sentence{System: true}
-	if !isSkip {
+	switch {
+	case !isSkip:
 		h.Room.Status[id] = StatusDc
-		sent.Content = fmt.Sprintf("Player `%s` has timed out.", h.Room.Members[id].Username)
-	} else {
+		h.Room.Out = append(h.Room.Out, id)
+		h.announce(fmt.Sprintf("Player `%s` has timed out.", h.Room.Members[id].Username))
+	case h.Room.Skips[id] < h.Room.Settings.AllowedSkips:
+		h.Room.Skips[id]++
+		h.Room.Status[id] = StatusActive
+		h.announce(fmt.Sprintf("Player `%s` has skipped (%d skips left).", h.Room.Members[id].Username, h.Room.Settings.AllowedSkips-h.Room.Skips[id]))
+	default:
 		h.Room.Status[id] = StatusOut
-		sent.Content = fmt.Sprintf("Player `%s` has skipped.", h.Room.Members[id].Username)
+		h.Room.Out = append(h.Room.Out, id)
+		h.announce(fmt.Sprintf("Player `%s` has skipped.", h.Room.Members[id].Username))
 	}
+}
+
+// announce adds a system announcement into the Room.
+func (h *RoomHandler) announce(content string) {
+	sent := Sentence{System: true, Content: content}
 	h.Room.Sentences = append(h.Room.Sentences, sent)
 	h.Broadcast(Message{
-		Type: "sentence",
-		Message: messageSentence{
+		Type: protocol.TypeSentence,
+		Message: protocol.NewSentence{
 			Sentence: sent,
 			Pos:      len(h.Room.Sentences) - 1,
 		},
 	})
 }
 
+// ErrGameEnded is returned when acting on a game that has already ended.
+var ErrGameEnded = errors.New("the game has already ended")
+
+// control runs f in the game loop, waiting for it to be done.
+// f returns whether the current turn ends.
+func (h *RoomHandler) control(f func() bool) error {
+	done := make(chan struct{})
+	select {
+	case h.controls <- func() bool { defer close(done); return f() }:
+		<-done
+		return nil
+	case <-h.ctx.Done():
+		return ErrGameEnded
+	}
+}
+
+// current returns a snapshot of the Room, taken by the game loop while it runs,
+// for the connections and handlers outside of it.
+func (h *RoomHandler) current() Room {
+	var room Room
+	take := func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		room = h.Room.snapshot()
+		return false
+	}
+	if h.control(take) == ErrGameEnded {
+		// Nothing else writes to an ended room.
+		take()
+	}
+	return room
+}
+
+// wait waits for the given time, while still running operator actions
+// and taking the requests that make sense outside of turns.
+func (h *RoomHandler) wait(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case f := <-h.controls:
+			f()
+		case req := <-h.inbox:
+			if req.VoteKick != nil {
+				h.voteKick(req.index, *req.VoteKick)
+			}
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+// Kick puts a member out of the game, on an operator's request.
+func (h *RoomHandler) Kick(index int) error {
+	if index < 0 || index >= len(h.Room.Members) {
+		return errors.New("member not found")
+	}
+	return h.control(func() bool {
+		if st := h.Room.Status[index]; st == StatusOut || st == StatusDc {
+			return false
+		}
+		return h.remove(index, StatusDc, fmt.Sprintf("Player `%s` has been kicked.", h.Room.Members[index].Username))
+	})
+}
+
+// remove puts a member out of the game with the given status, announcing why.
+// Returns whether the current turn ends.
+func (h *RoomHandler) remove(index int, status Status, content string) bool {
+	h.Room.Status[index] = status
+	h.Room.Out = append(h.Room.Out, index)
+	h.announce(content)
+	h.save()
+	return index == h.Room.Turn || h.Room.Ended()
+}
+
+// isActive returns whether the member is still in the game.
+func (r Room) isActive(index int) bool {
+	return r.Status[index] == StatusActive || r.Status[index] == StatusTurn
+}
+
+// voteKick counts a member's vote to kick another member, putting them out
+// once a majority of the other active members agree.
+// Returns whether the current turn ends.
+func (h *RoomHandler) voteKick(voter, target int) bool {
+	if voter < 0 || target < 0 || target >= len(h.Room.Members) || voter == target ||
+		!h.Room.isActive(voter) || !h.Room.isActive(target) {
+		return false
+	}
+	others := h.Room.active() - 1
+	if others < 2 {
+		// Otherwise, in a game of two, anyone could win by kicking the other.
+		return false
+	}
+	if h.kickVotes[target] == nil {
+		h.kickVotes[target] = make(map[int]bool)
+	}
+	h.kickVotes[target][voter] = true
+	// Voters who have gone out since do not count anymore.
+	votes := 0
+	for v := range h.kickVotes[target] {
+		if h.Room.isActive(v) {
+			votes++
+		}
+	}
+	needed := others/2 + 1
+	h.Broadcast(Message{
+		Type:    protocol.TypeVoteKick,
+		Message: protocol.VoteKick{Target: target, Votes: votes, Needed: needed},
+	})
+	if votes < needed {
+		return false
+	}
+	delete(h.kickVotes, target)
+	return h.remove(target, StatusOut, fmt.Sprintf("Player `%s` has been voted out.", h.Room.Members[target].Username))
+}
+
+// Redact removes the content of a sentence, on an operator's request.
+// Rooms that have ended are redacted too, so that exports and replays do not show it.
+func (h *RoomHandler) Redact(pos int) error {
+	var err error
+	redact := func() bool {
+		h.mu.Lock()
+		err = h.Room.Redact(pos)
+		h.mu.Unlock()
+		if err == nil {
+			h.Broadcast(Message{
+				Type:    protocol.TypeRedact,
+				Message: protocol.Redact{Pos: pos},
+			})
+			h.save()
+		}
+		return false
+	}
+	if h.control(redact) == ErrGameEnded {
+		// Nothing else writes to an ended room.
+		redact()
+	}
+	return err
+}
+
 func (h *RoomHandler) announceTurn(turn int) {
+	h.Room.Turn = turn
 	h.Room.Status[turn] = StatusTurn
 	sendStatus := make([]Status, len(h.Room.Status))
 	copy(sendStatus, h.Room.Status)
 	h.Broadcast(Message{
-		Type: "turn",
-		Message: messageTurn{
-			Status: sendStatus,
-			Time:   h.Room.Current,
+		Type: protocol.TypeTurn,
+		Message: protocol.Turn{
+			Status:   sendStatus,
+			Time:     h.Room.Current,
+			Progress: h.Room.Progress(),
 		},
 	})
 }
 
-// nextTurn announces the next turn, and, if ended, announces the end.
+// nextTurn announces the next turn, and, if ended, the final status.
 func (h *RoomHandler) nextTurn(last int) (int, bool) {
 	nxt, ended := h.Room.NextTurn(last)
+	if !ended && nxt <= last {
+		// Everyone has had their turn.
+		h.Room.Round++
+		if ended = h.Room.Ended(); ended {
+			nxt = h.Room.Winner()
+		}
+	}
 	if ended {
 		h.Broadcast(Message{
-			Type: "turn",
-			Message: messageTurn{
-				Status: h.Room.Status,
-				Time:   h.Room.Current,
+			Type: protocol.TypeTurn,
+			Message: protocol.Turn{
+				Status:   h.Room.Status,
+				Time:     h.Room.Current,
+				Progress: h.Room.Progress(),
 			},
 		})
-		h.Broadcast(Message{
-			Type:    "end",
-			Message: messageEnd{Winner: nxt},
-		})
 		return nxt, true
 	}
+	// The turn is moved on here rather than when announced, so that
+	// the Room saved in between resumes on the right player.
+	h.Room.Turn = nxt
 	h.Room.Current = time.Now()
 	return nxt, ended
 }
@@ -192,82 +509,266 @@ func shufflePlayers(players []User) {
 	}
 }
 
-// NewRoom creates a new room.
-func NewRoom(roomID int, players []User, timeout time.Duration, openSentence string) (h *RoomHandler) {
-	h = new(RoomHandler)
-	shufflePlayers(players)
+// newHandler creates a handler over the given Room.
+func newHandler(room Room, store RoomStore, onEnd func(Room), mod *Moderation) (h *RoomHandler, cancel context.CancelFunc) {
+	h = &RoomHandler{Room: room, store: store, onEnd: onEnd, mod: mod, inbox: make(chan request), controls: make(chan func() bool), kickVotes: make(map[int]map[int]bool)}
 	h.p = pconnMap{
 		Conns:  make(map[string]*PlayerConn),
 		Guests: make([]*PlayerConn, 0),
 	}
-	var cancel context.CancelFunc
 	h.ctx, cancel = context.WithCancel(context.Background())
+	return
+}
+
+// NewRoom creates a new room, saving it into the store.
+// onEnd, if not nil, is called with the final Room when the game ends.
+// mod, if not nil, filters the sentences, and has flagged usernames reported.
+func NewRoom(roomID int, players []User, settings RoomSettings, openSentence string, private bool, store RoomStore, onEnd func(Room), mod *Moderation) (*RoomHandler, error) {
+	shufflePlayers(players)
 	// Set the room up.
-	h.Room = Room{
+	h, cancel := newHandler(Room{
 		ID:        roomID,
 		Members:   players,
 		Status:    make([]Status, len(players)),
 		Sentences: []Sentence{Sentence{System: true, Content: openSentence}},
 		Start:     time.Now(),
-		Timeout:   timeout,
+		Settings:  settings,
+		Skips:     make([]int, len(players)),
+		Private:   private,
+	}, store, onEnd, mod)
+	for id, member := range players {
+		if _, flagged, _ := mod.Check(member.Username); flagged {
+			id := id
+			h.flag(Report{Member: &id})
+		}
+	}
+	if err := store.Save(h.Room); err != nil {
+		cancel()
+		return nil, err
 	}
 	go h.Play(cancel)
-	return
+	return h, nil
+}
+
+// resumeRoom restarts an in-progress game from its stored snapshot.
+func resumeRoom(room Room, store RoomStore, onEnd func(Room), mod *Moderation) *RoomHandler {
+	if len(room.Skips) != len(room.Members) {
+		// Saved by an older version.
+		room.Skips = make([]int, len(room.Members))
+	}
+	h, cancel := newHandler(room, store, onEnd, mod)
+	go h.resume(cancel)
+	return h
+}
+
+// archivedRoom returns a handler over a stored Room, whose game has ended.
+func archivedRoom(room Room, store RoomStore) *RoomHandler {
+	h := &RoomHandler{Room: room, store: store, p: pconnMap{Conns: make(map[string]*PlayerConn)}}
+	var cancel context.CancelFunc
+	h.ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	return h
 }
 
 // Play starts up the game.
 func (h *RoomHandler) Play(cancel context.CancelFunc) {
 	// Wait a while so that all players are connected.
-	<-time.After(10 * time.Second)
-	var (
-		turn  = 0
-		ended = h.Room.Ended()
-	)
+	h.wait(10 * time.Second)
 	h.Room.Current = time.Now()
+	h.play(cancel, 0)
+}
+
+// resume continues the game from the journaled turn, after the players had time to reconnect.
+func (h *RoomHandler) resume(cancel context.CancelFunc) {
+	h.wait(10 * time.Second)
+	// If the turn ran out while the server was down, the player gets a fresh one.
+	if time.Until(h.Room.Current.Add(h.Room.Settings.Timeout)) <= 0 {
+		h.Room.Current = time.Now()
+	}
+	log.Printf("Room %d resumed\n", h.Room.ID)
+	h.play(cancel, h.Room.Turn)
+}
+
+// play runs the game loop, starting from the given turn.
+func (h *RoomHandler) play(cancel context.CancelFunc, turn int) {
+	ended := h.Room.Ended()
+	// The game clock, if the game has a duration.
+	var over <-chan time.Time
+	if h.Room.Settings.Duration > 0 {
+		gameTimer := time.NewTimer(time.Until(h.Room.Deadline()))
+		defer gameTimer.Stop()
+		over = gameTimer.C
+	}
 	for !ended {
-		// Resets the timer so that it gives the proper time.
-		h.TurnTimer = time.NewTimer(h.Room.Current.Add(h.Room.Timeout).Sub(h.Room.Current))
-		conn, active := h.p.Get(h.Room.Members[turn].ID)
+		// Resets the timer so that it gives the proper (remaining) time.
+		h.TurnTimer = time.NewTimer(time.Until(h.Room.Current.Add(h.Room.Settings.Timeout)))
+		ID := h.Room.Members[turn].ID
+		conn, active := h.p.Get(ID)
 		h.announceTurn(turn)
+		h.save()
 		log.Printf("Room %d: Turn %d\n", h.Room.ID, turn)
 		if !active {
 			// User not even connected
 			h.addSkip(turn, false)
 		} else {
+			errChan := conn.ErrChan
 		awaitResp:
 			for {
 				select {
-				case resp := <-conn.Send:
-					if resp.Received.Sub(h.Room.Current) < 0 {
+				case resp := <-h.inbox:
+					if resp.VoteKick != nil {
+						if h.voteKick(resp.index, *resp.VoteKick) {
+							break awaitResp
+						}
 						continue awaitResp
 					}
-					if resp.IsSkip {
+					if resp.index != turn || resp.Vote != nil || resp.Received.Sub(h.Room.Current) < 0 {
+						continue awaitResp
+					}
+					if resp.Skip {
 						h.addSkip(turn, true)
-					} else if len(resp.Content) > 0 {
-						h.addSentence(turn, resp.Content)
-					} else {
+						break awaitResp
+					}
+					content, err := h.Room.CheckSentence(resp.Content)
+					if err == nil {
+						err = h.addSentence(turn, content)
+					}
+					if err != nil {
+						// The writer can try again within their turn.
+						go resp.conn.SendMessage(Message{
+							Type:    protocol.TypeRejected,
+							Message: protocol.Rejected{Reason: err.Error()},
+						})
 						continue awaitResp
 					}
 					break awaitResp
-				case err := <-conn.ErrChan:
-					log.Printf("Room %d, Player %d: %v\n", h.Room.ID, turn, err)
+				case <-errChan:
+					if next, ok := h.p.Get(ID); ok && next != conn {
+						// The player has reconnected, and goes on with their turn.
+						conn, errChan = next, next.ErrChan
+						continue awaitResp
+					}
+					log.Printf("Room %d, Player %d: %v\n", h.Room.ID, turn, conn.Error)
+					if h.reconnectGrace() > 0 {
+						// The player has until the turn timer, or the end of the grace period, to come back.
+						errChan = nil
+						continue awaitResp
+					}
 					h.addSkip(turn, false)
 					break awaitResp
 				case <-h.TurnTimer.C:
 					h.addSkip(turn, false)
 					break awaitResp
+				case <-over:
+					// Time is up for everyone; the turn ends without a penalty.
+					break awaitResp
+				case f := <-h.controls:
+					if f() {
+						break awaitResp
+					}
 				}
 			}
 		}
 		h.TurnTimer.Stop()
+		// Turns cut short by the clock or an operator leave the player active.
+		if h.Room.Status[turn] == StatusTurn {
+			h.Room.Status[turn] = StatusActive
+		}
 		turn, ended = h.nextTurn(turn)
+		h.save()
+	}
+	if h.Room.Settings.Voting && h.Room.Votes == nil {
+		h.vote()
 	}
+	h.Broadcast(Message{
+		Type:    protocol.TypeEnd,
+		Message: h.Room.endMessage(),
+	})
+	h.save()
 	log.Printf("Room %d ended\n", h.Room.ID)
+	// Crashing before the room is marked finished replays the end on resume;
+	// ratings are only applied once per room, so that only the tallies are redone.
+	if h.onEnd != nil {
+		h.onEnd(h.Room.snapshot())
+	}
+	h.Room.Finished = true
+	h.save()
 	cancel()
 }
 
+// voter identifies a member by index, or a guest by connection.
+type voter struct {
+	index int
+	conn  *PlayerConn
+}
+
+// vote runs the voting phase, then tallies the ballots into the Room.
+// Each voter's last valid ballot counts.
+func (h *RoomHandler) vote() {
+	m := &protocol.Vote{
+		Sentences: make([]int, 0),
+		Deadline:  time.Now().Add(h.Room.Settings.VoteTimeout),
+	}
+	for pos, sent := range h.Room.Sentences {
+		if !sent.System {
+			m.Sentences = append(m.Sentences, pos)
+		}
+	}
+	h.mu.Lock()
+	h.voting = m
+	h.mu.Unlock()
+	h.Broadcast(Message{Type: protocol.TypeVote, Message: *m})
+	log.Printf("Room %d: voting\n", h.Room.ID)
+
+	timer := time.NewTimer(time.Until(m.Deadline))
+	defer timer.Stop()
+	ballots := make(map[voter]Ballot)
+	// Without spectators, there is no need to wait once every member has voted.
+collect:
+	for h.Room.Settings.SpectatorVotes || len(ballots) < len(h.Room.Members) {
+		select {
+		case req := <-h.inbox:
+			if req.Vote == nil || !h.Room.ValidBallot(req.index, *req.Vote) {
+				continue
+			}
+			v := voter{index: req.index}
+			if req.index < 0 {
+				if !h.Room.Settings.SpectatorVotes {
+					continue
+				}
+				v.conn = req.conn
+			}
+			ballots[v] = *req.Vote
+		case f := <-h.controls:
+			f()
+		case <-timer.C:
+			break collect
+		}
+	}
+
+	h.mu.Lock()
+	h.voting = nil
+	h.mu.Unlock()
+	h.Room.Votes = make([]int, len(h.Room.Members))
+	for _, b := range ballots {
+		if b.Sentence != nil {
+			h.Room.Sentences[*b.Sentence].Votes++
+			h.Room.Votes[h.Room.Sentences[*b.Sentence].Owner]++
+		} else {
+			h.Room.Votes[*b.Author]++
+		}
+	}
+}
+
+// openVote returns the open voting phase, if any.
+func (h *RoomHandler) openVote() *protocol.Vote {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.voting
+}
+
 func (h *RoomHandler) serveInfoReqs(w http.ResponseWriter, r *http.Request) {
-	data, err := json.Marshal(h.Room)
+	data, err := json.Marshal(h.current())
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte("{\"error\": \"Server error\"}"))
@@ -276,51 +777,136 @@ func (h *RoomHandler) serveInfoReqs(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+// ServeHTTP serves the room, treating every connection as a guest.
 func (h *RoomHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, visitor{}, nil, DefaultHeartbeat())
+}
+
+// visitor identifies who is connecting to a room.
+type visitor struct {
+	ID      string // The player's ID, from a verified token.
+	Account string // The account the visitor is logged in to.
+	Err     error  // Set if the visitor presented a bad token.
+}
+
+// errNoSpectators is returned to visitors of a game without spectators who are not playing it.
+var errNoSpectators = errors.New("spectators are not allowed")
+
+// visible returns whether the visitor may follow the game: games without spectators
+// are only shown to their members until they have ended.
+func (h *RoomHandler) visible(v visitor) bool {
+	select {
+	case <-h.ctx.Done():
+		return true
+	default:
+	}
+	if h.Room.Settings.Spectators {
+		return true
+	}
+	if _, err := h.Room.Index(v.ID); err == nil {
+		return true
+	}
+	_, err := h.Room.AccountIndex(v.Account)
+	return v.Account != "" && err == nil
+}
+
+// serve serves the room. Players are identified by their token, or, if they are
+// registered, by the account they are logged in to.
+// Clients speak the protocol version negotiated from "v", and those resuming
+// with "since" are first sent the broadcasts they missed.
+// Connections are limited by lim, if not nil, and kept alive by hb.
+func (h *RoomHandler) serve(w http.ResponseWriter, r *http.Request, v visitor, lim *Limiter, hb Heartbeat) {
 	if r.Method == "POST" {
+		if !h.visible(v) {
+			writeError(w, 403, errNoSpectators)
+			return
+		}
 		h.serveInfoReqs(w, r)
 		return
 	}
-	conn, err := upgrader.Upgrade(w, r, nil)
+	if err := lim.Connect(clientIP(r)); err != nil {
+		writeError(w, 429, err)
+		return
+	}
+	openTransport(w, r, func(t Transport) { h.connect(t, r, v, lim, hb) })
+}
+
+// connect sets up a connection to the room, over the client's transport.
+func (h *RoomHandler) connect(t Transport, r *http.Request, v visitor, lim *Limiter, hb Heartbeat) {
+	version, err := protocol.Negotiate(r.FormValue("v"))
 	if err != nil {
+		t.CloseWith(protocol.CloseUnsupportedVersion, err.Error())
 		return
 	}
-	pConn := Prepare(conn)
+	h.mu.Lock()
+	h.grace = hb.Grace
+	h.mu.Unlock()
 	var ended bool
 	select {
 	case <-h.ctx.Done():
 		ended = true
 	default:
 	}
+	if v.Err != nil {
+		code := protocol.CloseInvalidToken
+		if v.Err == ErrExpiredToken {
+			code = protocol.CloseExpiredToken
+		}
+		t.CloseWith(code, v.Err.Error())
+		return
+	}
+	if !h.visible(v) {
+		t.CloseWith(protocol.CloseNoSpectators, errNoSpectators.Error())
+		return
+	}
+	index, err := h.Room.Index(v.ID)
+	if err != nil && v.Account != "" {
+		index, err = h.Room.AccountIndex(v.Account)
+	}
+	// A resuming client gives the sequence number of the first message it missed.
+	since, serr := strconv.Atoi(r.FormValue("since"))
+	if serr != nil {
+		since = -1
+	}
+	pConn := Prepare(t, lim.Conn(t, clientIP(r)), hb)
+	pConn.SendMessage(helloMessage(version))
 	// If ended, immediately quit to save memory.
 	if ended {
 		pConn.SendMessage(Message{
-			Type: "end",
-			Message: messageEnd{
-				Winner: h.Room.Winner(),
-			},
+			Type:    protocol.TypeEnd,
+			Message: h.Room.endMessage(),
 		})
+		pConn.Close()
 		return
 	}
 	// If this is a player, announce his index.
-	r.ParseForm()
-	index, err := h.Room.Index(r.FormValue("player"))
 	if err == nil {
-		ID := r.FormValue("player")
-		// Replace old player connection.
+		ID := h.Room.Members[index].ID
+		pConn.SendMessage(Message{
+			Type: protocol.TypeIndex,
+			Message: protocol.Index{
+				Index: index,
+			},
+		})
+		// Replace old player connection, once the new one is in place.
 		oldConn, ok := h.p.Get(ID)
+		h.attach(ID, pConn, since)
 		if ok {
 			oldConn.Close()
 		}
-		pConn.SendMessage(Message{
-			Type: "index",
-			Message: messageIndex{
-				Index: index,
-			},
+		h.Broadcast(Message{
+			Type:    protocol.TypeJoin,
+			Message: protocol.Join{Index: index},
 		})
-		h.p.Set(ID, pConn)
+		go h.watch(index, pConn, hb.Grace)
+		go h.pump(index, pConn)
 	} else {
 		// Guest,
-		h.p.Guest(pConn)
+		h.attach("", pConn, since)
+		go h.pump(-1, pConn)
+	}
+	// Latecomers still get to vote.
+	if m := h.openVote(); m != nil {
+		pConn.SendMessage(Message{Type: protocol.TypeVote, Message: *m})
 	}
 }
@@ -1,9 +1,10 @@
 package backend
 
 import (
-	"errors"
+	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -11,34 +12,216 @@ import (
 // Rooms implement a Room container.
 type Rooms struct {
 	mu    sync.Mutex
-	Rooms []*RoomHandler // As an array, for easy numbering and in-memory management.
+	Rooms []*RoomHandler // As an array, for easy numbering and in-memory management. Rooms only found in Store are nil.
+	Store RoomStore      // The Room storage. If nil, an in-memory store is used.
+	// The time a finished room stays live before being archived. Archived rooms
+	// have their connections closed, and are served from the Store afterwards.
+	Grace time.Duration
+	// Called with the final Room snapshot of every finished game.
+	OnEnd []func(Room)
+	// The account system, letting registered players rejoin their rooms by session.
+	Accounts *Accounts
+	// The player token signer. If nil, one with a random key is used.
+	Signer *Signer
+	// The content filter of sentences. If nil, sentences are not filtered.
+	Moderation *Moderation
+	// The flood protection of room connections. If nil, there is none.
+	Limiter *Limiter
+	// The keep-alive setting of room connections. If zero, the default one is used.
+	Heartbeat Heartbeat
+}
+
+// ended runs the end-of-game listeners.
+func (r *Rooms) ended(room Room) {
+	for _, f := range r.OnEnd {
+		f(room)
+	}
+}
+
+// init makes sure the storage is set up, and that new IDs do not collide with stored rooms.
+// It must be called with the lock held.
+func (r *Rooms) init() error {
+	if r.Store == nil {
+		r.Store = MemoryStore()
+	}
+	if r.Signer == nil {
+		r.Signer = NewSigner(nil, 24*time.Hour)
+	}
+	if r.Heartbeat == (Heartbeat{}) {
+		r.Heartbeat = DefaultHeartbeat()
+	}
+	if r.Rooms == nil {
+		n, err := r.Store.Len()
+		if err != nil {
+			return err
+		}
+		r.Rooms = make([]*RoomHandler, n)
+	}
+	return nil
 }
 
 // New creates a new room(handler) and return its id.
-func (r *Rooms) New(players []User, timeout time.Duration, openSentence string) (id int, err error) {
+func (r *Rooms) New(players []User, settings RoomSettings, openSentence string) (id int, err error) {
+	return r.newRoom(players, settings, openSentence, false)
+}
+
+// NewPrivate creates a new room that is not publicly listed.
+func (r *Rooms) NewPrivate(players []User, settings RoomSettings, openSentence string) (id int, err error) {
+	return r.newRoom(players, settings, openSentence, true)
+}
+
+func (r *Rooms) newRoom(players []User, settings RoomSettings, openSentence string, private bool) (id int, err error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if r.Rooms == nil {
-		r.Rooms = make([]*RoomHandler, 0)
+	if err := r.init(); err != nil {
+		return 0, err
+	}
+	h, err := NewRoom(len(r.Rooms), players, settings, openSentence, private, r.Store, r.ended, r.Moderation)
+	if err != nil {
+		return 0, err
 	}
-	r.Rooms = append(r.Rooms, NewRoom(len(r.Rooms), players, timeout, openSentence))
+	r.Rooms = append(r.Rooms, h)
+	go r.archive(len(r.Rooms)-1, h)
 	return len(r.Rooms) - 1, nil
 }
 
+// Resume restarts every in-progress game found in the store, so that players
+// can reconnect and continue after a server restart.
+// It should be called once, before the server starts serving.
+func (r *Rooms) Resume() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.init(); err != nil {
+		return err
+	}
+	for id, h := range r.Rooms {
+		if h != nil {
+			continue
+		}
+		room, err := r.Store.Load(id)
+		if err == ErrRoomNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// Games interrupted after they ended are resumed too, to finish the vote and record the results.
+		if len(room.Members) == 0 || room.Finished {
+			continue
+		}
+		h = resumeRoom(room, r.Store, r.ended, r.Moderation)
+		r.Rooms[id] = h
+		go r.archive(id, h)
+	}
+	return nil
+}
+
+// Token issues the player's token to join the room.
+func (r *Rooms) Token(id int, player User) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.init()
+	return r.Signer.Sign(player.ID, id)
+}
+
+// archive waits for the room to end, then frees the live handler after the grace period.
+func (r *Rooms) archive(id int, h *RoomHandler) {
+	<-h.Done()
+	<-time.After(r.Grace)
+	h.Close()
+	r.mu.Lock()
+	r.Rooms[id] = nil
+	r.mu.Unlock()
+}
+
 // Get returns the room with the specified ID.
+// Rooms that are not live are loaded from the store as read-only.
 func (r *Rooms) Get(id int) (*RoomHandler, error) {
-	if len(r.Rooms) <= id {
-		return nil, errors.New("no such room")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.init(); err != nil {
+		return nil, err
+	}
+	if id < 0 || len(r.Rooms) <= id {
+		return nil, ErrRoomNotFound
+	}
+	if r.Rooms[id] != nil {
+		return r.Rooms[id], nil
+	}
+	room, err := r.Store.Load(id)
+	if err != nil {
+		return nil, err
 	}
-	return r.Rooms[id], nil
+	return archivedRoom(room, r.Store), nil
+}
+
+// roomInfo is a public room listing entry.
+type roomInfo struct {
+	ID      int       `json:"id"`
+	Members []User    `json:"members"`
+	Start   time.Time `json:"start"`
+	Ended   bool      `json:"ended"`
+}
+
+// List returns the live public rooms.
+func (r *Rooms) List() []roomInfo {
+	list := make([]roomInfo, 0)
+	for _, h := range r.Live() {
+		room := h.current()
+		if room.Private {
+			continue
+		}
+		list = append(list, roomInfo{
+			ID:      room.ID,
+			Members: room.Members,
+			Start:   room.Start,
+			Ended:   room.Ended(),
+		})
+	}
+	return list
+}
+
+// PendingReports returns the reports waiting for review, from every room.
+func (r *Rooms) PendingReports() ([]PendingReport, error) {
+	r.mu.Lock()
+	if err := r.init(); err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	store := r.Store
+	r.mu.Unlock()
+	return PendingReports(store)
+}
+
+// Live returns the live room handlers, private ones included.
+func (r *Rooms) Live() []*RoomHandler {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	live := make([]*RoomHandler, 0)
+	for _, h := range r.Rooms {
+		if h != nil {
+			live = append(live, h)
+		}
+	}
+	return live
 }
 
 func (r *Rooms) ServeHTTP(w http.ResponseWriter, rq *http.Request) {
 	if len(rq.URL.EscapedPath()) <= len("/rooms/") {
-		w.WriteHeader(403)
+		if rq.Method != "GET" {
+			w.WriteHeader(403)
+			return
+		}
+		data, _ := json.Marshal(r.List())
+		w.Write(data)
 		return
 	}
+	// The path is /rooms/{id} or /rooms/{id}/{action}.
 	idStr := rq.URL.EscapedPath()[len("/rooms/"):]
+	var action string
+	if slash := strings.IndexByte(idStr, '/'); slash >= 0 {
+		idStr, action = idStr[:slash], idStr[slash+1:]
+	}
 	println(idStr)
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -51,14 +234,39 @@ func (r *Rooms) ServeHTTP(w http.ResponseWriter, rq *http.Request) {
 		w.Write([]byte("{\"error\": \"" + err.Error() + "\"}"))
 		return
 	}
-	room.ServeHTTP(w, rq)
+	var v visitor
+	if token := rq.FormValue("token"); token != "" {
+		r.mu.Lock()
+		signer := r.Signer
+		r.mu.Unlock()
+		v.ID, v.Err = signer.Verify(token, id)
+	}
+	if r.Accounts != nil {
+		v.Account, _ = r.Accounts.Session(rq.FormValue("session"))
+	}
+	switch action {
+	case "":
+		r.mu.Lock()
+		hb := r.Heartbeat
+		r.mu.Unlock()
+		room.serve(w, rq, v, r.Limiter, hb)
+	case "export":
+		room.serveExport(w, rq, v)
+	case "replay":
+		room.serveReplay(w, rq, v)
+	default:
+		w.WriteHeader(404)
+	}
 }
 
 // RoomManager is an interface for a RoomManager.
 type RoomManager interface {
 	http.Handler
-	New(players []User, timeout time.Duration, openSentence string) (id int, err error)
+	New(players []User, settings RoomSettings, openSentence string) (id int, err error)
+	NewPrivate(players []User, settings RoomSettings, openSentence string) (id int, err error)
 	Get(id int) (*RoomHandler, error)
+	// Token issues the player's token to join the room.
+	Token(id int, player User) string
 }
 
 var _ RoomManager = (*Rooms)(nil)
@@ -1,9 +1,11 @@
 package backend
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -15,17 +17,33 @@ type Server struct {
 	http.Server
 	c  Config
 	op OpenSentencer
-	q  *Queue
+	q  *Queues
+	l  *Lobbies
 	r  RoomManager
+	s  Services
 }
 
-// Welcome returns a welcome message.
+// Services are the optional parts of the server. Nil services are disabled.
+type Services struct {
+	Ratings     *Ratings  // Without ratings, matchmaking ignores ratings.
+	Accounts    *Accounts // Without accounts, usernames are not reserved.
+	Profiles    *Profiles
+	Leaderboard *Leaderboard
+	Moderation  *Moderation // Without moderation, usernames are not filtered.
+	Bans        *Bans       // Without bans, nobody is banned.
+	Limiter     *Limiter    // Without a limiter, there is no flood protection.
+	Admin       *Admin      // Without the admin API, operators cannot intervene.
+}
+
+// Welcome returns a welcome message, listing all queues.
 func (s *Server) Welcome(w http.ResponseWriter, r *http.Request) {
-	s.q.mu.Lock()
-	defer s.q.mu.Unlock()
-	w.Write([]byte(
-		fmt.Sprintf("\"Welcome to Hakkero Project %s! You will join a %d-player room with a timeout of %d seconds.\\nThere are %d users online waiting for a room...\"", Version, s.c.PlayerLimit, int64(s.c.Timeout/time.Second), len(s.q.Players)),
-	))
+	var b strings.Builder
+	fmt.Fprintf(&b, "Welcome to Hakkero Project %s! By default, you will join a %d-player %s room with a timeout of %d seconds.", Version, s.c.PlayerLimit, DefaultMode, int64(s.c.Settings.Timeout/time.Second))
+	for _, q := range s.q.List() {
+		fmt.Fprintf(&b, "\nThere are %d users online waiting for a %d-player %s room...", q.Waiting, q.Players, q.Mode)
+	}
+	data, _ := json.Marshal(b.String())
+	w.Write(data)
 }
 
 func enableCORS(h http.Handler) http.Handler {
@@ -51,17 +69,37 @@ func handlerApply(h http.Handler, funcs ...func(http.Handler) http.Handler) http
 }
 
 // NewServer returns a new server.
-func NewServer(c Config, op OpenSentencer, r RoomManager) *Server {
+func NewServer(c Config, op OpenSentencer, r RoomManager, s Services) *Server {
 	srv := &Server{
 		c:  c,
 		op: op,
 		r:  r,
-		q:  NewQueue(r, c, op),
+		q:  NewQueues(r, c, op, s.Ratings, s.Accounts, s.Moderation, s.Bans, s.Limiter),
+		l:  NewLobbies(r, c, op, s.Accounts, s.Moderation, s.Bans, s.Limiter),
+		s:  s,
 	}
 	mux := http.NewServeMux()
 	srv.Handler = handlerApply(mux, logRequest, enableCORS)
 	mux.HandleFunc("/", srv.Welcome)
 	mux.Handle("/rooms/", srv.r)
 	mux.Handle("/queue", srv.q)
+	mux.HandleFunc("/queues", srv.q.serveList)
+	mux.Handle("/lobbies", srv.l)
+	mux.Handle("/lobbies/", srv.l)
+	mux.Handle("/transport/", sessions)
+	if s.Accounts != nil {
+		mux.Handle("/register", s.Accounts)
+		mux.Handle("/login", s.Accounts)
+		mux.Handle("/logout", s.Accounts)
+	}
+	if s.Profiles != nil {
+		mux.Handle("/users/", s.Profiles)
+	}
+	if s.Leaderboard != nil {
+		mux.Handle("/leaderboard", s.Leaderboard)
+	}
+	if s.Admin != nil {
+		mux.Handle("/admin/", s.Admin)
+	}
 	return srv
 }
@@ -0,0 +1,34 @@
+package backend
+
+import "errors"
+
+// ErrRoomNotFound is returned by a RoomStore when no Room with the given ID is stored.
+var ErrRoomNotFound = errors.New("no such room")
+
+// RoomStore represents a storage of Room snapshots.
+// Snapshots are written every time the game state changes, so that finished
+// (and in-progress) stories survive a server restart.
+type RoomStore interface {
+	// Save writes the Room snapshot, overwriting the one with the same ID.
+	Save(r Room) error
+	// Load fetches the Room snapshot with the given ID.
+	Load(id int) (Room, error)
+	// Len returns the number of stored Rooms. Room IDs are numbered from 0, so this is also the next free ID.
+	Len() (int, error)
+	// Each calls f on every stored Room, in ID order, stopping at the first error.
+	Each(f func(Room) error) error
+}
+
+// snapshot returns a deep copy of the Room, safe to be stored while the game goes on.
+func (r Room) snapshot() Room {
+	c := r
+	c.Members = append([]User(nil), r.Members...)
+	c.Status = append([]Status(nil), r.Status...)
+	c.Sentences = append([]Sentence(nil), r.Sentences...)
+	c.Skips = append([]int(nil), r.Skips...)
+	c.Out = append([]int(nil), r.Out...)
+	c.Votes = append([]int(nil), r.Votes...)
+	c.Reports = append([]Report(nil), r.Reports...)
+	c.Events = append([]Event(nil), r.Events...)
+	return c
+}
@@ -0,0 +1,253 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// This file contains the persistent stores backed by an on-disk BoltDB database.
+// Values are gob-encoded, since the JSON form of an User does not carry its ID.
+
+var (
+	bucketRooms    = []byte("rooms")
+	bucketRatings  = []byte("ratings")
+	bucketRated    = []byte("rated") // The rooms whose game has been rated.
+	bucketAccounts = []byte("accounts")
+	bucketBans     = []byte("bans")
+	bucketSessions = []byte("sessions")
+)
+
+// BoltDB is an on-disk database, providing all persistent stores.
+type BoltDB struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens (or creates) a BoltDB database at path.
+func OpenBolt(path string) (*BoltDB, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "open database")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{bucketRooms, bucketRatings, bucketRated, bucketAccounts, bucketBans, bucketSessions} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "create buckets")
+	}
+	return &BoltDB{db}, nil
+}
+
+// Close closes the database.
+func (b *BoltDB) Close() error {
+	return b.db.Close()
+}
+
+// put gob-encodes the value into the bucket.
+func (b *BoltDB) put(bucket, key []byte, v interface{}) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return errors.Wrapf(err, "encode %s", bucket)
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key, buf.Bytes())
+	})
+}
+
+// get decodes the value from the bucket, returning notFound if there is none.
+func (b *BoltDB) get(bucket, key []byte, v interface{}, notFound error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucket).Get(key)
+		if data == nil {
+			return notFound
+		}
+		return errors.Wrapf(gob.NewDecoder(bytes.NewReader(data)).Decode(v), "decode %s", bucket)
+	})
+}
+
+// Rooms returns a RoomStore using the database.
+func (b *BoltDB) Rooms() RoomStore {
+	return boltRooms{b}
+}
+
+// Ratings returns a RatingStore using the database.
+func (b *BoltDB) Ratings() RatingStore {
+	return boltRatings{b}
+}
+
+// Accounts returns an AccountStore using the database.
+func (b *BoltDB) Accounts() AccountStore {
+	return boltAccounts{b}
+}
+
+// Bans returns a BanStore using the database.
+func (b *BoltDB) Bans() BanStore {
+	return boltBans{b}
+}
+
+type boltRooms struct{ *BoltDB }
+
+func roomKey(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+func (b boltRooms) Save(r Room) error {
+	return b.put(bucketRooms, roomKey(r.ID), r)
+}
+
+func (b boltRooms) Load(id int) (r Room, err error) {
+	if id < 0 {
+		return r, ErrRoomNotFound
+	}
+	err = b.get(bucketRooms, roomKey(id), &r, ErrRoomNotFound)
+	return
+}
+
+func (b boltRooms) Len() (n int, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		key, _ := tx.Bucket(bucketRooms).Cursor().Last()
+		if key != nil {
+			n = int(binary.BigEndian.Uint64(key)) + 1
+		}
+		return nil
+	})
+	return
+}
+
+func (b boltRooms) Each(f func(Room) error) error {
+	// Rooms are decoded within the transaction, but f is called outside of it, as f may take a while.
+	var rooms []Room
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketRooms).ForEach(func(_, data []byte) error {
+			var r Room
+			if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&r); err != nil {
+				return errors.Wrap(err, "decode rooms")
+			}
+			rooms = append(rooms, r)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for _, r := range rooms {
+		if err := f(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type boltRatings struct{ *BoltDB }
+
+func (b boltRatings) Get(name string) (r Rating, err error) {
+	err = b.get(bucketRatings, []byte(name), &r, nil)
+	if err == nil && r.Games == 0 {
+		r = NewRating()
+	}
+	return
+}
+
+func (b boltRatings) Put(room int, ratings map[string]Rating) error {
+	encoded := make(map[string][]byte, len(ratings))
+	for name, r := range ratings {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(r); err != nil {
+			return errors.Wrapf(err, "encode %s", bucketRatings)
+		}
+		encoded[name] = buf.Bytes()
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		rated := tx.Bucket(bucketRated)
+		if rated.Get(roomKey(room)) != nil {
+			return ErrRated
+		}
+		for name, data := range encoded {
+			if err := tx.Bucket(bucketRatings).Put([]byte(name), data); err != nil {
+				return err
+			}
+		}
+		return rated.Put(roomKey(room), []byte{1})
+	})
+}
+
+type boltAccounts struct{ *BoltDB }
+
+func (b boltAccounts) Get(name string) (a Account, err error) {
+	err = b.get(bucketAccounts, []byte(name), &a, ErrAccountNotFound)
+	return
+}
+
+func (b boltAccounts) Create(a Account) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(a); err != nil {
+		return errors.Wrap(err, "encode account")
+	}
+	// Checking and writing within the same transaction, so that a name cannot be taken twice.
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketAccounts)
+		if bucket.Get([]byte(a.Username)) != nil {
+			return ErrAccountExists
+		}
+		return bucket.Put([]byte(a.Username), buf.Bytes())
+	})
+}
+
+func (b boltAccounts) GetSession(key string) (s LoginSession, err error) {
+	err = b.get(bucketSessions, []byte(key), &s, ErrSessionNotFound)
+	return
+}
+
+func (b boltAccounts) PutSession(key string, s LoginSession) error {
+	return b.put(bucketSessions, []byte(key), s)
+}
+
+func (b boltAccounts) DeleteSession(key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSessions).Delete([]byte(key))
+	})
+}
+
+func (b boltAccounts) PruneSessions(now time.Time) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketSessions).Cursor()
+		for key, data := c.First(); key != nil; key, data = c.Next() {
+			var s LoginSession
+			if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s); err != nil {
+				return errors.Wrapf(err, "decode %s", bucketSessions)
+			}
+			if now.After(s.Expires) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// keyBans is the key of the list of bans, kept as a whole.
+var keyBans = []byte("all")
+
+type boltBans struct{ *BoltDB }
+
+func (b boltBans) List() (bans []Ban, err error) {
+	err = b.get(bucketBans, keyBans, &bans, nil)
+	return
+}
+
+func (b boltBans) Save(bans []Ban) error {
+	return b.put(bucketBans, keyBans, bans)
+}
@@ -0,0 +1,55 @@
+package backend
+
+import "sync"
+
+// This file contains an in-memory RoomStore. Nothing is kept after the server stops.
+
+type memoryStore struct {
+	mu    sync.RWMutex
+	rooms []Room
+}
+
+func (m *memoryStore) Save(r Room) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for len(m.rooms) <= r.ID {
+		m.rooms = append(m.rooms, Room{ID: len(m.rooms)})
+	}
+	m.rooms[r.ID] = r.snapshot()
+	return nil
+}
+
+func (m *memoryStore) Load(id int) (Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if id < 0 || id >= len(m.rooms) {
+		return Room{}, ErrRoomNotFound
+	}
+	return m.rooms[id].snapshot(), nil
+}
+
+func (m *memoryStore) Len() (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.rooms), nil
+}
+
+func (m *memoryStore) Each(f func(Room) error) error {
+	m.mu.RLock()
+	rooms := make([]Room, len(m.rooms))
+	for id, r := range m.rooms {
+		rooms[id] = r.snapshot()
+	}
+	m.mu.RUnlock()
+	for _, r := range rooms {
+		if err := f(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryStore returns a RoomStore that keeps everything in memory.
+func MemoryStore() RoomStore {
+	return &memoryStore{}
+}
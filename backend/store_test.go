@@ -0,0 +1,107 @@
+package backend
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testBolt returns a new database, closed when the test ends.
+func testBolt(t *testing.T) *BoltDB {
+	db, err := OpenBolt(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestRoomStore(t *testing.T) {
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	room := func(id int) Room {
+		return Room{
+			ID:        id,
+			Members:   []User{{ID: "a", Username: "alice", Registered: true}, {ID: "b", Username: "bob"}},
+			Status:    []Status{StatusActive, StatusOut},
+			Sentences: []Sentence{{Content: "Once upon a time.", System: true}, {Content: "There was a dog.", Owner: 0}},
+			Out:       []int{1},
+			Start:     start,
+			Current:   start.Add(time.Minute),
+		}
+	}
+	stores := []struct {
+		name  string
+		store RoomStore
+	}{
+		{"memory", MemoryStore()},
+		{"bolt", testBolt(t).Rooms()},
+	}
+	for _, s := range stores {
+		if n, err := s.store.Len(); n != 0 || err != nil {
+			t.Errorf("%s: empty Len() = %d, %v; want 0, nil", s.name, n, err)
+		}
+		for id := 0; id < 3; id++ {
+			if err := s.store.Save(room(id)); err != nil {
+				t.Errorf("%s: Save(%d) = %v", s.name, id, err)
+			}
+		}
+		overwritten := room(1)
+		overwritten.Finished = true
+		s.store.Save(overwritten)
+
+		tests := []struct {
+			id   int
+			want Room
+			err  error
+		}{
+			{0, room(0), nil},
+			{1, overwritten, nil},
+			{2, room(2), nil},
+			{3, Room{}, ErrRoomNotFound},
+			{-1, Room{}, ErrRoomNotFound},
+		}
+		for _, tt := range tests {
+			got, err := s.store.Load(tt.id)
+			if err != tt.err || err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: Load(%d) = %+v, %v; want %+v, %v", s.name, tt.id, got, err, tt.want, tt.err)
+			}
+		}
+		if n, err := s.store.Len(); n != 3 || err != nil {
+			t.Errorf("%s: Len() = %d, %v; want 3, nil", s.name, n, err)
+		}
+		var ids []int
+		s.store.Each(func(r Room) error {
+			ids = append(ids, r.ID)
+			return nil
+		})
+		if !reflect.DeepEqual(ids, []int{0, 1, 2}) {
+			t.Errorf("%s: Each() visited %v; want [0 1 2]", s.name, ids)
+		}
+		stop := errors.New("stop")
+		if err := s.store.Each(func(r Room) error { return stop }); err != stop {
+			t.Errorf("%s: Each() = %v; want the error of f", s.name, err)
+		}
+	}
+}
+
+func TestBoltReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Rooms().Save(Room{ID: 0, Members: []User{{ID: "a", Username: "alice"}}})
+	db.Close()
+
+	db, err = OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	r, err := db.Rooms().Load(0)
+	if err != nil || len(r.Members) != 1 || r.Members[0].Username != "alice" {
+		t.Errorf("Load() after reopening = %+v, %v; want the saved room", r, err)
+	}
+}
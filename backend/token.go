@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Token errors.
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("expired token")
+)
+
+// tokenClaims is the content of a player token.
+type tokenClaims struct {
+	User    string `json:"u"` // The player's ID.
+	Room    int    `json:"r"`
+	Expires int64  `json:"e"` // Unix time.
+}
+
+// Signer issues and verifies player tokens. A token is an HMAC-signed claim
+// that the holder is a given player of a given room, so that seats cannot
+// be taken by anyone who only knows the room.
+type Signer struct {
+	key      []byte
+	Lifetime time.Duration // The time a token stays valid.
+}
+
+// NewSigner returns a signer using the key. If the key is empty, a random one
+// is used, and tokens do not survive a server restart.
+func NewSigner(key []byte, lifetime time.Duration) *Signer {
+	if len(key) == 0 {
+		key = []byte(randToken())
+	}
+	return &Signer{key: key, Lifetime: lifetime}
+}
+
+func (s *Signer) mac(payload string) string {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// Sign issues a token for the player with the given ID in the room.
+func (s *Signer) Sign(userID string, room int) string {
+	data, _ := json.Marshal(tokenClaims{
+		User:    userID,
+		Room:    room,
+		Expires: time.Now().Add(s.Lifetime).Unix(),
+	})
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + s.mac(payload)
+}
+
+// Verify checks the token for the room, and returns the player's ID.
+func (s *Signer) Verify(token string, room int) (string, error) {
+	dot := strings.IndexByte(token, '.')
+	if dot < 0 || !hmac.Equal([]byte(s.mac(token[:dot])), []byte(token[dot+1:])) {
+		return "", ErrInvalidToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token[:dot])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(data, &claims); err != nil || claims.Room != room {
+		return "", ErrInvalidToken
+	}
+	if time.Now().Unix() > claims.Expires {
+		return "", ErrExpiredToken
+	}
+	return claims.User, nil
+}
@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignerVerify(t *testing.T) {
+	s := NewSigner([]byte("key"), time.Hour)
+	token := s.Sign("player", 3)
+
+	// A payload claiming another player, keeping the original MAC.
+	data, _ := json.Marshal(tokenClaims{User: "intruder", Room: 3, Expires: time.Now().Add(time.Hour).Unix()})
+	mac := token[strings.IndexByte(token, '.')+1:]
+	forged := base64.RawURLEncoding.EncodeToString(data) + "." + mac
+
+	// The MAC with its last character changed.
+	last := "A"
+	if strings.HasSuffix(token, last) {
+		last = "B"
+	}
+	tamperedMAC := token[:len(token)-1] + last
+
+	expired := NewSigner([]byte("key"), -time.Minute).Sign("player", 3)
+
+	tests := []struct {
+		name  string
+		token string
+		room  int
+		user  string
+		err   error
+	}{
+		{"round trip", token, 3, "player", nil},
+		{"wrong room", token, 4, "", ErrInvalidToken},
+		{"tampered payload", forged, 3, "", ErrInvalidToken},
+		{"tampered MAC", tamperedMAC, 3, "", ErrInvalidToken},
+		{"expired", expired, 3, "", ErrExpiredToken},
+		{"no dot", strings.Replace(token, ".", "", 1), 3, "", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		user, err := s.Verify(tt.token, tt.room)
+		if user != tt.user || err != tt.err {
+			t.Errorf("%s: Verify() = %q, %v; want %q, %v", tt.name, user, err, tt.user, tt.err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport carries the messages of a client connection.
+//
+// Clients pick the transport with the "transport" parameter when connecting:
+// "websocket" (the default), "sse" to receive Server-Sent Events, or "poll" to
+// long-poll. With the last two, the client sends its messages by POSTing them
+// to /transport/{session}, and long-polling clients GET it for new messages.
+// The session and the polls' framing are part of the protocol package.
+type Transport interface {
+	ReadJSON(v interface{}) error
+	WriteJSON(v interface{}) error
+	SetReadDeadline(t time.Time) error
+	SetReadLimit(limit int64)
+	SetPongHandler(h func(appData string) error)
+	Ping(deadline time.Time) error           // Pings the client, who answers through the pong handler.
+	CloseWith(code int, reason string) error // Closes the transport, telling the client why.
+	Close() error
+	RemoteAddr() net.Addr
+}
+
+// wsTransport is a websocket Transport.
+type wsTransport struct {
+	*websocket.Conn
+}
+
+// Ping sends a ping control message.
+func (t wsTransport) Ping(deadline time.Time) error {
+	return t.WriteControl(websocket.PingMessage, nil, deadline)
+}
+
+// CloseWith sends a close control message, then closes the connection.
+func (t wsTransport) CloseWith(code int, reason string) error {
+	t.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	return t.Conn.Close()
+}
+
+// openTransport opens the transport the client asked for, and hands it to attach.
+// Websockets are attached right away. HTTP transports are attached aside, as the
+// handler goes on to serve the client's event stream or first poll.
+func openTransport(w http.ResponseWriter, r *http.Request, attach func(Transport)) {
+	switch mode := r.FormValue("transport"); mode {
+	case "", "websocket":
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		attach(wsTransport{conn})
+	case "sse", "poll":
+		t := sessions.open(r, mode == "sse")
+		go attach(t)
+		if t.stream {
+			t.serveStream(w, r)
+		} else {
+			t.servePoll(w, r)
+		}
+	default:
+		writeError(w, 400, errors.New("unknown transport"))
+	}
+}
@@ -1,6 +1,8 @@
 package backend
 
 import (
+	cryptorand "crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"math/rand"
 )
@@ -9,8 +11,9 @@ import (
 // In this implementation we will NOT save user information into the database, as we allow
 // register-less entrances. Therefore, we would like User to be as simple as possible.
 type User struct {
-	ID       string
-	Username string
+	ID         string
+	Username   string
+	Registered bool // Whether the user is logged in to the account with the same username.
 }
 
 // MarshalJSON turns an user into a JSON string.
@@ -44,6 +47,20 @@ func randStringBytesMaskImpr(n int) string {
 	return string(b)
 }
 
+// randToken returns a random, unguessable token for use as a secret.
+func randToken() string {
+	b := make([]byte, 24)
+	if _, err := cryptorand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// validUsername checks whether the username can be used.
+func validUsername(username string) bool {
+	return len(username) > 0 && len(username) <= 20
+}
+
 // NewUser creates a new unique user.
 func NewUser(username string) User {
 	return User{
@@ -0,0 +1,160 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// SentenceRule is a step of the sentence validation pipeline.
+// It returns an error, describing the reason to the writer, if the sentence is rejected.
+type SentenceRule func(s RoomSettings, content string) error
+
+// SentenceRules are the rules every sentence goes through, in order, after being normalised.
+var SentenceRules = []SentenceRule{
+	checkLength,
+	checkWords,
+	checkPunctuation,
+	checkSingleSentence,
+}
+
+// terminals are the runes that end a sentence.
+const terminals = ".!?…。！？"
+
+// fullWidthTerminals are the terminals of scripts written without spaces.
+const fullWidthTerminals = "。！？"
+
+// closers are the runes that may follow the end of a sentence.
+const closers = "\"')]}”’»」』"
+
+// invisibles are the format characters dropped from sentences: zero-width spaces, soft hyphens
+// and direction marks. Joiners and emoji tags are kept, as emoji sequences need them.
+var invisibles = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00ad, Hi: 0x00ad, Stride: 1}, // Soft hyphen
+		{Lo: 0x061c, Hi: 0x061c, Stride: 1}, // Arabic letter mark
+		{Lo: 0x180e, Hi: 0x180e, Stride: 1}, // Mongolian vowel separator
+		{Lo: 0x200b, Hi: 0x200b, Stride: 1}, // Zero-width space
+		{Lo: 0x200e, Hi: 0x200f, Stride: 1}, // Direction marks
+		{Lo: 0x202a, Hi: 0x202e, Stride: 1}, // Direction embeddings and overrides
+		{Lo: 0x2060, Hi: 0x2064, Stride: 1}, // Word joiner and invisible operators
+		{Lo: 0x2066, Hi: 0x2069, Stride: 1}, // Direction isolates
+		{Lo: 0xfeff, Hi: 0xfeff, Stride: 1}, // Byte order mark
+	},
+}
+
+// NormaliseSentence puts the sentence in Unicode normal form, drops control and invisible characters,
+// and collapses runs of whitespace into single spaces.
+func NormaliseSentence(content string) string {
+	content = norm.NFC.String(content)
+	var b strings.Builder
+	space := false
+	for _, r := range content {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case unicode.IsControl(r) || unicode.Is(invisibles, r):
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteRune(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// CheckSentence normalises the sentence, then runs it through the pipeline.
+// It returns the normalised sentence, or the first rule's error.
+func (r Room) CheckSentence(content string) (string, error) {
+	content = NormaliseSentence(content)
+	for _, rule := range SentenceRules {
+		if err := rule(r.Settings, content); err != nil {
+			return "", err
+		}
+	}
+	return content, nil
+}
+
+func checkLength(s RoomSettings, content string) error {
+	length := utf8.RuneCountInString(content)
+	switch {
+	case length == 0:
+		return errors.New("the sentence is empty")
+	case length < s.MinLength:
+		return fmt.Errorf("the sentence must be at least %d characters long", s.MinLength)
+	case s.MaxLength > 0 && length > s.MaxLength:
+		return fmt.Errorf("the sentence must be at most %d characters long", s.MaxLength)
+	}
+	return nil
+}
+
+func checkWords(s RoomSettings, content string) error {
+	if s.MaxWords > 0 && len(strings.Fields(content)) > s.MaxWords {
+		return fmt.Errorf("the sentence must have at most %d words", s.MaxWords)
+	}
+	return nil
+}
+
+func checkPunctuation(s RoomSettings, content string) error {
+	if !s.Punctuation {
+		return nil
+	}
+	last, _ := utf8.DecodeLastRuneInString(strings.TrimRight(content, closers))
+	if !strings.ContainsRune(terminals, last) {
+		return errors.New("the sentence must end with a punctuation mark")
+	}
+	return nil
+}
+
+// checkSingleSentence rejects text where a sentence ends and another one begins.
+// Abbreviations such as "Mr. Smith" are rejected too; writers can do without them.
+// Ellipses, as in "Wait... what?", are pauses rather than ends.
+func checkSingleSentence(s RoomSettings, content string) error {
+	if !s.SingleSentence {
+		return nil
+	}
+	// A sentence ends at a terminal followed by a space, so that "3.14" is fine.
+	ended, gap := false, false
+	var run []rune // The terminals since the sentence last ended.
+	for _, r := range content {
+		switch {
+		case strings.ContainsRune(terminals, r):
+			if !ended {
+				run = run[:0]
+			}
+			run = append(run, r)
+			ended = true
+			// Full-width terminals are not followed by spaces.
+			gap = gap || strings.ContainsRune(fullWidthTerminals, r)
+		case !ended:
+		case unicode.IsSpace(r):
+			gap = true
+		case strings.ContainsRune(closers, r):
+		case gap && !isEllipsis(run):
+			return errors.New("only one sentence is allowed")
+		default:
+			ended, gap = false, false
+		}
+	}
+	return nil
+}
+
+// isEllipsis reports whether the run of terminals is an ellipsis: "…", or two periods or more.
+func isEllipsis(run []rune) bool {
+	if len(run) == 1 {
+		return run[0] == '…'
+	}
+	for _, r := range run {
+		if r != '.' && r != '…' {
+			return false
+		}
+	}
+	return len(run) > 0
+}
@@ -0,0 +1,67 @@
+package backend
+
+import "testing"
+
+func TestNormaliseSentence(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"whitespace", "  Once \t upon\n\na time ", "Once upon a time"},
+		{"control characters", "Once\x00 upon\x07 a time", "Once upon a time"},
+		{"zero-width space", "Once\u200b upon a time", "Once upon a time"},
+		{"soft hyphen", "Once up\u00adon a time", "Once upon a time"},
+		{"direction override", "\u202eOnce upon a time\u202c", "Once upon a time"},
+		{"byte order mark", "\ufeffOnce upon a time", "Once upon a time"},
+		{"composition", "Cafe\u0301", "Caf\u00e9"},
+		{"ZWJ emoji", "A family 👨\u200d👩\u200d👧 walks.", "A family 👨\u200d👩\u200d👧 walks."},
+		{"flag emoji", "A flag 🏴\U000e0067\U000e0062\U000e0073\U000e0063\U000e0074\U000e007f waves.", "A flag 🏴\U000e0067\U000e0062\U000e0073\U000e0063\U000e0074\U000e007f waves."},
+		{"ZWNJ", "می\u200cخواهم", "می\u200cخواهم"},
+	}
+	for _, tt := range tests {
+		if got := NormaliseSentence(tt.content); got != tt.want {
+			t.Errorf("%s: NormaliseSentence(%q) = %q; want %q", tt.name, tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSentence(t *testing.T) {
+	strict := DefaultSettings()
+	strict.MinLength, strict.MaxLength, strict.MaxWords = 5, 40, 6
+	strict.Punctuation, strict.SingleSentence = true, true
+
+	tests := []struct {
+		name     string
+		settings RoomSettings
+		content  string
+		ok       bool
+	}{
+		{"plain", strict, "The dog barked.", true},
+		{"empty", DefaultSettings(), " \u200b ", false},
+		{"too short", strict, "Hi.", false},
+		{"too long", strict, "The dog barked at the mailman all day long.", false},
+		{"too many words", strict, "A b c d e f g.", false},
+		{"no punctuation", strict, "The dog barked", false},
+		{"no punctuation allowed", DefaultSettings(), "The dog barked", true},
+		{"closing quote", strict, "He said \"no.\"", true},
+		{"two sentences", strict, "It rained. We left.", false},
+		{"two sentences allowed", DefaultSettings(), "It rained. We left.", true},
+		{"decimal", strict, "Pi is 3.14 roughly.", true},
+		{"abbreviation", strict, "Mr. Smith left.", false},
+		{"quoted end", strict, "\"Stop!\" Then silence.", false},
+		{"full-width", strict, "雨が降った。帰った。", false},
+		{"full-width single", strict, "雨が降った。", true},
+		{"ellipsis", strict, "Wait... what?", true},
+		{"ellipsis rune", strict, "Wait… what?", true},
+		{"two periods", strict, "Wait.. what?", true},
+		{"ellipsis then end", strict, "Wait... what? No.", false},
+		{"trailing ellipsis", strict, "And then...", true},
+	}
+	for _, tt := range tests {
+		_, err := Room{Settings: tt.settings}.CheckSentence(tt.content)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: CheckSentence(%q) = %v; want ok = %v", tt.name, tt.content, err, tt.ok)
+		}
+	}
+}
@@ -23,8 +23,7 @@ function validate(roomID) {
 }
 
 function validateID(ID) {
-  if (!(ID.length === 0 || ID.length === 32)) return false;
-  return /^[a-zA-Z]*$/.test(ID);
+  return /^[a-zA-Z0-9_.-]*$/.test(ID);
 }
 
 export default connect(
@@ -116,10 +115,10 @@ class viewIDInput extends Component {
         controlId="ID"
         validationState={validateID(ID) ? 'success' : 'error'}
       >
-        <ControlLabel>, maybe under the ID </ControlLabel>
+        <ControlLabel>, maybe with the token </ControlLabel>
         <FormControl
           type="text"
-          placeholder="Your player ID (optional)"
+          placeholder="Your player token (optional)"
           value={ID}
           onChange={event => this.handleChange(event)}
           style={{ marginLeft: '10px' }}
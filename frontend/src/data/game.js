@@ -14,14 +14,17 @@ Contains
 		start: Date,
 		current: Date,
 		timeout: int,
+		settings: object,
 	} | null,
 	"ended": <int | null>,
 	"myID": <int, null>,
 	"sentence": <string>,
+	"seq": <int | null>, // The sequence number of the next expected broadcast.
 }
 */
 
 import Config from '../config';
+import { VERSION } from '../protocol';
 import { RESET } from './id';
 import { combineReducers } from 'redux';
 
@@ -32,6 +35,7 @@ const ROOM_SENTENCE = 'GAME_ROOM_SENTENCE';
 const MYID = 'GAME_MYID_CHANGE';
 const SENTENCE = 'GAME_SENTENCE_CHANGE';
 const ENDED = 'GAME_ENDED_CHANGE';
+const SEQ = 'GAME_SEQ_CHANGE';
 
 /**
  * Handles incoming messages.
@@ -44,6 +48,11 @@ function gameMessageDispatcher(ws, event, dispatch, state) {
     console.log(event.data);
     const data = JSON.parse(event.data);
     const payload = data.message;
+    if (data.seq !== undefined) {
+      // Already seen before reconnecting.
+      if (state.game.seq !== null && data.seq < state.game.seq) return;
+      dispatch({ type: SEQ, payload: data.seq + 1 });
+    }
     switch (data.type) {
       case 'index':
         return dispatch({ type: MYID, payload: payload.index });
@@ -52,7 +61,7 @@ function gameMessageDispatcher(ws, event, dispatch, state) {
       case 'sentence':
         return dispatch({ type: ROOM_SENTENCE, payload: payload });
       case 'end':
-        return dispatch({ type: ENDED, payload: payload.Winner });
+        return dispatch({ type: ENDED, payload: payload.winner });
       default:
     }
   } catch (e) {
@@ -67,13 +76,14 @@ export function initRoom() {
   return async (dispatch, getState) => {
     let res = null;
     try {
-      const id = getState().roomID;
-      res = await fetch(Config.server + `/rooms/${id}`, { method: 'POST' });
+      const { roomID, ID } = getState();
+      // Games without spectators are only shown to their players.
+      res = await fetch(Config.server + `/rooms/${roomID}?token=${ID}`, { method: 'POST' });
       if (!res.ok) {
         throw new Error(res.statusText);
       }
       res = await res.json();
-      res.timeout /= 1000000000;
+      res.timeout = res.settings.timeout / 1000000000;
     } catch (e) {
       res = null;
       console.log(e);
@@ -97,7 +107,12 @@ export function actionConnect() {
   return (dispatch, getState) => {
     const state = getState();
     const { roomID, ID } = state;
-    const ws = new WebSocket(Config.wsServer + `/rooms/${roomID}?player=${ID}`);
+    const { seq } = state.game;
+    // Resume from the first missed broadcast, if we have been connected before.
+    const since = seq === null ? '' : `&since=${seq}`;
+    const ws = new WebSocket(
+      Config.wsServer + `/rooms/${roomID}?v=${VERSION}&token=${ID}${since}`
+    );
     dispatch({ type: WS, payload: ws });
     ws.addEventListener('error', ev => {
       // Error occurred
@@ -231,13 +246,27 @@ function reduceSentence(sent = '', action) {
   return sent;
 }
 
+/**
+ * Reduces the next expected sequence number.
+ * @param {Number} seq
+ * @param {*} action
+ * @return {Number}
+ */
+function reduceSeq(seq = null, action) {
+  if (action.type === SEQ) {
+    return action.payload;
+  }
+  return seq;
+}
+
 export function reduceGame(game = {}, action) {
   const rG = combineReducers({
     ws: reduceWS,
     room: reduceRoom,
     ended: reduceEnded,
     myID: reduceMyID,
-    sentence: reduceSentence
+    sentence: reduceSentence,
+    seq: reduceSeq
   });
   if (action.type === RESET) {
     return rG({}, action);
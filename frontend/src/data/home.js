@@ -18,6 +18,7 @@ Contains
 import { combineReducers } from 'redux';
 import { actionRoomID, actionID, ID, RESET } from './id';
 import Config from '../config';
+import { VERSION } from '../protocol';
 
 const USERNAME = 'HOME_USERNAME_CHANGE';
 const WS = 'HOME_WS_CHANGE';
@@ -52,6 +53,7 @@ function queueMessageDispatcher(w, event, dispatch) {
     switch (data.type) {
       case 'announcement':
         if (payload.success) {
+          dispatch(actionID(payload.token));
           setTimeout(() => dispatch(actionRoomID(payload.room)), 1000);
         } else dispatch({ type: FOUND, payload: new Date() });
         return dispatch({ type: CONSOLE, payload: payload.announcement });
@@ -59,8 +61,6 @@ function queueMessageDispatcher(w, event, dispatch) {
         return dispatch({ type: QUEUE_SIZE, payload: payload.size });
       case 'found':
         return dispatch({ type: FOUND, payload: 'pending' });
-      case 'ID':
-        return dispatch(actionID(payload.ID));
       default:
     }
   } catch (e) {
@@ -75,7 +75,11 @@ function queueMessageDispatcher(w, event, dispatch) {
 export function actionConnect() {
   return (dispatch, getState) => {
     const ws = new WebSocket(
-      Config.wsServer + '/queue?username=' + getState().home.username
+      Config.wsServer +
+        '/queue?v=' +
+        VERSION +
+        '&username=' +
+        getState().home.username
     );
     ws.addEventListener('open', ev => {
       dispatch({
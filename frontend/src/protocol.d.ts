@@ -0,0 +1,159 @@
+// Code generated by hakkero-protocol-gen. DO NOT EDIT.
+
+export declare const VERSION: 1;
+export declare const CLOSE_INVALID_TOKEN: 4001;
+export declare const CLOSE_EXPIRED_TOKEN: 4002;
+export declare const CLOSE_UNSUPPORTED_VERSION: 4003;
+export declare const CLOSE_NO_SPECTATORS: 4004;
+export declare const CLOSE_RATE_LIMITED: 4005;
+
+export interface Announcement {
+  success: boolean;
+  room: number;
+  token?: string;
+  announcement?: string;
+}
+
+export interface Disconnect {
+  index: number;
+}
+
+export interface End {
+  winner: number;
+  votes?: number[];
+  sentenceVotes?: number[];
+  voteWinner: number;
+}
+
+export interface Found {}
+
+export interface Hello {
+  version: number;
+}
+
+export interface Index {
+  index: number;
+}
+
+export interface Join {
+  index: number;
+}
+
+export interface Lobby {
+  code: string;
+  members: string[];
+  host: boolean;
+}
+
+export interface Redact {
+  pos: number;
+}
+
+export interface Rejected {
+  reason: string;
+}
+
+export interface Reported {
+  id: number;
+}
+
+export interface NewSentence {
+  sentence: Sentence;
+  pos: number;
+}
+
+export interface Sentence {
+  content: string;
+  owner: number;
+  system?: boolean;
+  votes?: number;
+  flagged?: boolean;
+  redacted?: boolean;
+}
+
+export interface QueueSize {
+  size: number;
+}
+
+export interface Turn {
+  status: Status[];
+  current: string;
+  progress: Progress;
+}
+
+export type Status = "active" | "skipped" | "disconnected" | "turn";
+
+export interface Progress {
+  roundsLeft?: number;
+  wordsLeft?: number;
+  deadline?: string;
+}
+
+export interface Vote {
+  sentences: number[];
+  deadline: string;
+}
+
+export interface VoteKick {
+  target: number;
+  votes: number;
+  needed: number;
+}
+
+export interface Request {
+  skip?: boolean;
+  content?: string;
+  vote?: Ballot;
+  report?: Report;
+  votekick?: number;
+}
+
+export interface Ballot {
+  sentence?: number;
+  author?: number;
+}
+
+export interface Report {
+  sentence?: number;
+  member?: number;
+  reason: string;
+}
+
+export interface QueueResponse {
+  accepted?: boolean;
+  start?: boolean;
+}
+
+export interface Session {
+  session: string;
+}
+
+export interface PollResponse {
+  session: string;
+  messages: Message[];
+  closed?: SessionClosed;
+}
+
+export interface SessionClosed {
+  code: number;
+  reason: string;
+}
+
+/** A message from the server. */
+export type Message =
+  | { type: "announcement"; message: Announcement; seq?: number }
+  | { type: "disconnect"; message: Disconnect; seq?: number }
+  | { type: "end"; message: End; seq?: number }
+  | { type: "found"; message: Found; seq?: number }
+  | { type: "hello"; message: Hello; seq?: number }
+  | { type: "index"; message: Index; seq?: number }
+  | { type: "join"; message: Join; seq?: number }
+  | { type: "lobby"; message: Lobby; seq?: number }
+  | { type: "redact"; message: Redact; seq?: number }
+  | { type: "rejected"; message: Rejected; seq?: number }
+  | { type: "reported"; message: Reported; seq?: number }
+  | { type: "sentence"; message: NewSentence; seq?: number }
+  | { type: "size"; message: QueueSize; seq?: number }
+  | { type: "turn"; message: Turn; seq?: number }
+  | { type: "vote"; message: Vote; seq?: number }
+  | { type: "votekick"; message: VoteKick; seq?: number };